@@ -17,17 +17,21 @@ limitations under the License.
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 const acroVersion = "0.1.0-alpha"
 const defaultConfigName = "default"
 
 var configRoot string
-var term *Term
+var term console
 var config *configuration
 
 var headersCommand *mapCommand
@@ -36,6 +40,20 @@ var settingsCommand *mapCommand
 
 var commands map[string]command
 
+//
+// The number of commands which have failed, when running non-interactively any failure results in a
+// non-zero exit code.
+//
+var failures int
+
+var startConfig = flag.String("c", defaultConfigName, "Name of the configuration to use")
+var scriptFile = flag.String("f", "", "Run the commands in `script` and exit")
+var expressions commandList
+
+func init() {
+	flag.Var(&expressions, "e", "Run `command` and exit, may be given more than once")
+}
+
 var getCommand = &httpCommand{method: "GET"}
 var deleteCommand = &httpCommand{method: "DELETE"}
 var headCommand = &httpCommand{method: "HEAD"}
@@ -46,7 +64,20 @@ var configCommand = &configurationCommand{}
 func main() {
 	var err error
 
-	term = createTerm(0)
+	flag.Parse()
+
+	//
+	// We only run the REPL when attached to a terminal and haven't been given anything else to do,
+	// otherwise commands come from -e, -f or stdin.
+	//
+	interactive := len(expressions) == 0 && len(*scriptFile) == 0 && terminal.IsTerminal(0)
+	var rawTerm *Term
+	if interactive {
+		rawTerm = createTerm(0)
+		term = rawTerm
+	} else {
+		term = newPlainConsole(os.Stdin, os.Stdout)
+	}
 	config = defaultConfig()
 
 	//
@@ -58,17 +89,29 @@ func main() {
 		term.printf("Couldn't determine config root, using defaults: %s\n", err)
 	} else {
 
+		//
+		// Command history is shared by all configurations
+		//
+		h, err := loadHistory(filepath.Join(configRoot, historyFileName), maxHistory)
+		if err != nil {
+			term.printf("Couldn't load history: %s\n", err)
+		}
+		commandHistory = h
+
 		//
 		// Determine the path of the config file we are starting with.  This call cannot fail if the configRoot
 		// isn't empty, so we can ignore the error value.
 		//
-		configFile, _ := getConfigPath(defaultConfigName)
+		configFile, _ := getConfigPath(*startConfig)
 
 		//
-		// Attempt to read the default configuration, if it doesn't exist create it.
+		// Attempt to read the starting configuration, if it's the default and doesn't exist create it.
 		//
-		conf, err := loadConfig(defaultConfigName, configFile)
-		if os.IsNotExist(err) {
+		conf, err := loadConfig(*startConfig, configFile)
+		if os.IsNotExist(err) && *startConfig != defaultConfigName {
+			term.printf("No such configuration '%s'\n", *startConfig)
+			os.Exit(1)
+		} else if os.IsNotExist(err) {
 			term.writeString("No settings file found, using defaults\n")
 			configFile, err = getConfigPath(defaultConfigName)
 			if err != nil {
@@ -94,13 +137,18 @@ func main() {
 
 	}
 
+	initCommands(config)
+	useCookies(term, config)
+
+	if !interactive {
+		os.Exit(runNonInteractive())
+	}
+
 	updatePrompt()
 	term.printf("Acromantula %s\n", acroVersion)
 	term.writeString("Hit Ctrl+D to quit\n")
 
-	defer term.restoreTerm()
-
-	initCommands(config)
+	defer rawTerm.restoreTerm()
 
 	for {
 		tokens, err := term.readline()
@@ -110,16 +158,7 @@ func main() {
 			break
 		}
 
-		if len(tokens) == 0 || len(tokens[0]) == 0 {
-			continue
-		}
-
-		cmd := commands[strings.ToLower(tokens[0])]
-		if cmd == nil {
-			term.writeString(fmt.Sprintf("Unknown command, %v\r\n", tokens[0]))
-		} else {
-			cmd.exec(tokens, term, config)
-		}
+		runCommand(tokens)
 		// switch tokens[0] {
 		// case "header":
 		// 	headersCommand.exec(tokens, term, config)
@@ -162,18 +201,60 @@ func initCommands(config *configuration) {
 	commands["delete"] = &httpCommand{method: "DELETE"}
 	commands["post"] = &httpBodyCommand{method: "POST"}
 	commands["put"] = &httpBodyCommand{method: "PUT"}
+	commands["patch"] = &httpBodyCommand{method: "PATCH"}
+	commands["options"] = &httpCommand{method: "OPTIONS"}
+	commands["request"] = &requestCommand{}
 	commands["config"] = &configurationCommand{}
 	commands["help"] = &helpCommand{}
+	commands["extract"] = &extractCommand{}
+	commands["last"] = &lastCommand{}
+	commands["!!"] = &replayCommand{}
+	commands["download"] = &downloadCommand{}
+	commands["import"] = &importCommand{}
+	commands["export"] = &exportCommand{}
+	commands["save-request"] = &saveRequestCommand{}
+	commands["run"] = &runRequestsCommand{}
+	commands["requests"] = &requestsCommand{}
+	commands["http-file"] = &httpFileCommand{}
+	commands["record"] = &recordCommand{}
+	commands["replay"] = &harReplayCommand{}
+	commands["vars"] = &mapCommand{desc: "Session variables, referenced in requests as {{name}} (though not inside @file bodies)", backingMap: variables}
+	commands["var"] = commands["vars"]
+	commands["history"] = &historyCommand{}
+	commands["cookies"] = &cookiesCommand{}
+	commands["cookie"] = commands["cookies"]
 
 	updateCommands(config)
 }
 
+//
+// runCommand executes a single tokenized command line, returning false if it failed.
+//
+func runCommand(tokens []string) bool {
+	if len(tokens) == 0 || len(tokens[0]) == 0 {
+		return true
+	}
+
+	before := failures
+
+	cmd := commands[strings.ToLower(tokens[0])]
+	if cmd == nil {
+		term.writeString(fmt.Sprintf("Unknown command, %v\n", tokens[0]))
+		failures++
+	} else {
+		cmd.exec(tokens, term, config)
+	}
+
+	return failures == before
+}
+
 func updateCommands(config *configuration) {
-	commands["headers"] = &mapCommand{desc: "Headers for all HTTP(S) requests", backingMap: config.settings.Headers}
+	commands["headers"] = &mapCommand{desc: "Headers for all HTTP(S) requests", backingMap: config.settings.Headers, suggestions: knownHeaders}
 	commands["header"] = commands["headers"]
 	commands["params"] = &mapCommand{desc: "Request parameters for all HTTP(S) requests", backingMap: config.settings.Params}
 	commands["param"] = commands["params"]
-	commands["settings"] = &mapCommand{desc: "Application level settings and preferences", backingMap: config.settings.Settings}
+	commands["settings"] = &mapCommand{desc: "Application level settings and preferences", backingMap: config.settings.Settings,
+		suggestions: knownSettingNames(), validate: validateSetting}
 	commands["setting"] = commands["settings"]
 }
 
@@ -0,0 +1,325 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+const defaultConnectTimeout = 30 * time.Second
+const defaultTLSTimeout = 10 * time.Second
+const defaultMaxRedirects = 10
+
+var transport = &http.Transport{DisableKeepAlives: false, Proxy: http.ProxyFromEnvironment}
+var client = &http.Client{Timeout: defaultTimeout, Transport: &harTransport{next: transport}}
+
+//
+// The settings which affect how the client and transport are built, whenever one of these changes the
+// transport is rebuilt before the next request.
+//
+var transportSettings = []string{"proxy", "ca-bundle", "client-cert", "client-key", "tls-min-version", "sni", "insecure",
+	"timeout", "connect-timeout", "tls-timeout", "header-timeout", "redirects", "max-redirects", "keep-alive"}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// The values of transportSettings the current transport was built with.
+var builtWith = ""
+
+//
+// configureClient rebuilds the transport if any of the settings it depends on have changed since it was
+// last built.
+//
+func configureClient(config *configuration) error {
+	values := make([]string, len(transportSettings))
+	for i, key := range transportSettings {
+		values[i] = key + "=" + config.settings.Settings[key]
+	}
+
+	fingerprint := strings.Join(values, "\n")
+	if fingerprint == builtWith {
+		return nil
+	}
+
+	t, err := newTransport(config.settings.Settings)
+	if err != nil {
+		return err
+	}
+
+	transport.CloseIdleConnections()
+	transport = t
+	client.Transport = &harTransport{next: t}
+	client.Timeout = durationSettingValue(config.settings.Settings, "timeout", defaultTimeout)
+	client.CheckRedirect = redirectPolicy(config.settings.Settings)
+	builtWith = fingerprint
+	return nil
+}
+
+//
+// streamingClient returns a client for requests whose body or response is streamed, which may take any
+// time at all.  Rather than the client's overall timeout, the returned request is cancelled if the
+// response's headers don't arrive within it, see idleTimeout.
+//
+func streamingClient(req *http.Request) (*http.Client, *http.Request, *idleTimeout) {
+	streaming := *client
+	streaming.Timeout = 0
+
+	ctx, cancel := context.WithCancel(req.Context())
+	idle := &idleTimeout{timeout: client.Timeout, cancel: cancel}
+	if idle.timeout > 0 {
+		idle.timer = time.AfterFunc(idle.timeout, idle.expire)
+	}
+	return &streaming, req.WithContext(ctx), idle
+}
+
+//
+// idleTimeout cancels a request once its timer expires, the timer is restarted by touch and
+// stopped by done.
+//
+type idleTimeout struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired int32
+}
+
+func (t *idleTimeout) expire() {
+	atomic.StoreInt32(&t.expired, 1)
+	t.cancel()
+}
+
+func (t *idleTimeout) touch() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+//
+// done stops the timer, the request is left to run for as long as it needs.
+//
+func (t *idleTimeout) done() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+//
+// release cancels the request's context once it's finished with.
+//
+func (t *idleTimeout) release() {
+	t.done()
+	t.cancel()
+}
+
+//
+// wrap replaces the context's cancellation error with a timeout, if that's why it was cancelled.
+//
+func (t *idleTimeout) wrap(err error) error {
+	if err != nil && atomic.LoadInt32(&t.expired) == 1 {
+		return fmt.Errorf("no response within %v", t.timeout)
+	}
+	return err
+}
+
+func newTransport(settings map[string]string) (*http.Transport, error) {
+	proxy, err := proxyFunc(settings["proxy"])
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   durationSettingValue(settings, "connect-timeout", defaultConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+
+	//
+	// Starting from the default transport keeps HTTP/2 and its connection pooling, only the configured
+	// behaviour is replaced
+	//
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxy
+	t.TLSClientConfig = tlsConfig
+	t.DialContext = dialer.DialContext
+	t.TLSHandshakeTimeout = durationSettingValue(settings, "tls-timeout", defaultTLSTimeout)
+	t.ResponseHeaderTimeout = durationSettingValue(settings, "header-timeout", 0)
+	t.DisableKeepAlives = !boolSettingValue(settings, "keep-alive", true)
+	t.ForceAttemptHTTP2 = true
+	return t, nil
+}
+
+//
+// redirectPolicy either follows redirects, printing each hop, up to max-redirects or, if redirects is
+// 'none', doesn't follow them at all so that the redirect response itself is shown.
+//
+func redirectPolicy(settings map[string]string) func(*http.Request, []*http.Request) error {
+	follow := settings["redirects"] != "none"
+	max := intSettingValue(settings, "max-redirects", defaultMaxRedirects)
+
+	return func(req *http.Request, via []*http.Request) error {
+		if !follow {
+			return http.ErrUseLastResponse
+		}
+
+		if len(via) > max {
+			return fmt.Errorf("Stopped after %d redirects", max)
+		}
+
+		term.writeString("\n<<  ")
+		term.underscore()
+		term.printf("HTTP %v\n", req.Response.Status)
+		term.reset()
+		term.printf(" <  Location : %v\n", req.Response.Header["Location"])
+
+		term.writeString("\n<<  ")
+		term.underscore()
+		term.printf("%v %v\n", req.Method, req.URL)
+		term.reset()
+		return nil
+	}
+}
+
+//
+// newTLSConfig builds the TLS configuration from the ca-bundle, client-cert, client-key, tls-min-version,
+// sni and insecure settings.
+//
+func newTLSConfig(settings map[string]string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         settings["sni"],
+		InsecureSkipVerify: isInsecure(settings),
+	}
+
+	//
+	// A CA bundle adds to the system's roots rather than replacing them
+	//
+	if bundle := settings["ca-bundle"]; len(bundle) > 0 {
+		pem, err := ioutil.ReadFile(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't read CA bundle: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", bundle)
+		}
+		config.RootCAs = pool
+	}
+
+	cert, key := settings["client-cert"], settings["client-key"]
+	if len(cert) > 0 || len(key) > 0 {
+		//
+		// The key may be bundled in the same PEM file as the certificate
+		//
+		if len(key) == 0 {
+			key = cert
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	if version := settings["tls-min-version"]; len(version) > 0 {
+		minVersion, ok := tlsVersions[version]
+		if !ok {
+			return nil, fmt.Errorf("Unknown tls-min-version '%s', try one of [1.0, 1.1, 1.2, 1.3]", version)
+		}
+		config.MinVersion = minVersion
+	}
+
+	return config, nil
+}
+
+func isInsecure(settings map[string]string) bool {
+	return boolSettingValue(settings, "insecure", false)
+}
+
+//
+// proxyFunc determines how requests are proxied.  An http://, https:// or socks5:// URL (optionally with
+// credentials) proxies every request, 'none' disables proxying, and if unset HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY from the environment are honoured.
+//
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch strings.ToLower(proxy) {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "none", "off":
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("Bad proxy URL '%s': %v", proxy, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("Unsupported proxy '%s', must be an http://, https:// or socks5:// URL", proxy)
+	}
+
+	if len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("Bad proxy URL '%s', no host given", proxy)
+	}
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+//
+// proxyFor returns the proxy the request will be sent through, with any password masked,
+// or an empty string if it will be sent directly.
+//
+func proxyFor(req *http.Request) string {
+	if transport.Proxy == nil {
+		return ""
+	}
+
+	proxyURL, err := transport.Proxy(req)
+	if err != nil || proxyURL == nil {
+		return ""
+	}
+
+	if proxyURL.User != nil {
+		if _, hasPassword := proxyURL.User.Password(); hasPassword {
+			return fmt.Sprintf("%s://%s:****@%s", proxyURL.Scheme, proxyURL.User.Username(), proxyURL.Host)
+		}
+	}
+	return proxyURL.String()
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Characters which can't appear in the name of an imported request, collection or configuration
+var importedNamePattern = regexp.MustCompile(`[^A-Za-z0-9_.\-]+`)
+
+type importedVariable struct {
+	key   string
+	value string
+}
+
+//
+// importedEnvironment is a set of variables from another tool, which becomes a configuration of its own.
+//
+type importedEnvironment struct {
+	name   string
+	values []importedVariable
+}
+
+//
+// importedCollection holds everything read from another tool's export, ready to be saved.  Its
+// variables are set on the active configuration and its environments become configurations.
+//
+type importedCollection struct {
+	name         string
+	requests     []*savedRequest
+	variables    []importedVariable
+	environments []importedEnvironment
+	warnings     []string
+
+	// Set once a request using another tool's dynamic variables, such as {{$guid}}, has been warned about
+	dynamic bool
+}
+
+func (c *importedCollection) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+//
+// importedName turns a name from another tool into one which can be used for a request, collection
+// or configuration, falling back to fallback if nothing usable is left.
+//
+func importedName(name, fallback string) string {
+	name = strings.Trim(importedNamePattern.ReplaceAllString(name, "-"), "-")
+	if len(name) == 0 {
+		return fallback
+	}
+	return name
+}
+
+func joinFolder(folder, name string) string {
+	name = importedName(name, "folder")
+	if len(folder) == 0 {
+		return name
+	}
+	return folder + "/" + name
+}
+
+//
+// add appends r to the collection as name within folder, numbering it if the name has already been used.
+//
+func (c *importedCollection) add(folder, name string, r *savedRequest) {
+	path := importedName(name, "request")
+	if len(folder) > 0 {
+		path = folder + "/" + path
+	}
+
+	unique := path
+	for n := 2; c.find(unique) != nil; n++ {
+		unique = fmt.Sprintf("%s-%d", path, n)
+	}
+	r.setPath(unique)
+	c.requests = append(c.requests, r)
+
+	text := r.URL + r.Body + strings.Join(r.Items, "")
+	if !c.dynamic && strings.Contains(text, "{{$") {
+		c.dynamic = true
+		c.warn("%s uses dynamic variables such as {{$guid}}, which acromantula doesn't support", unique)
+	}
+}
+
+func (c *importedCollection) find(path string) *savedRequest {
+	for _, r := range c.requests {
+		if r.path() == path {
+			return r
+		}
+	}
+	return nil
+}
+
+//
+// basicAuth adds an Authorization header for user and password, which can only be encoded up front
+// when neither refers to a variable.
+//
+func (c *importedCollection) basicAuth(name string, r *savedRequest, user, password string) {
+	if variablePattern.MatchString(user + password) {
+		c.warn("%s uses basic authentication with variables, its Authorization header will need to be set by hand", name)
+		return
+	}
+	r.Items = append(r.Items, "Authorization:Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+}
+
+//
+// setContentType adds a Content-Type header item to r, unless it already has one.
+//
+func setContentType(r *savedRequest, contentType string) {
+	for _, token := range r.Items {
+		item, err := parseRequestItem(token)
+		if err == nil && item.kind == headerItem && strings.EqualFold(item.key, "Content-Type") {
+			return
+		}
+	}
+	r.Items = append(r.Items, "Content-Type:"+contentType)
+}
+
+//
+// formEncode encodes fields as a form body, leaving {{name}} references intact so they're substituted
+// when the request is sent.
+//
+func formEncode(fields [][2]string) string {
+	encoded := make([]string, len(fields))
+	for i, field := range fields {
+		encoded[i] = escapeOutsideVariables(field[0]) + "=" + escapeOutsideVariables(field[1])
+	}
+	return strings.Join(encoded, "&")
+}
+
+func escapeOutsideVariables(s string) string {
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range variablePattern.FindAllStringIndex(s, -1) {
+		buf.WriteString(url.QueryEscape(s[last:loc[0]]))
+		buf.WriteString(s[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	buf.WriteString(url.QueryEscape(s[last:]))
+	return buf.String()
+}
+
+//
+// importFile reads a file exported by another tool with parse and saves what it contains.  The optional
+// name replaces the collection's name, or the environment's when the file is a single environment.
+//
+func importFile(args []string, term console, config *configuration, parse func([]byte) (*importedCollection, error)) {
+	if len(args) == 0 || len(args) > 2 {
+		term.printf("Please supply a file to import, and optionally the name to import it as\n")
+		failures++
+		return
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		term.printf("Couldn't read %s: %v\n", args[0], err)
+		failures++
+		return
+	}
+
+	imported, err := parse(data)
+	if err != nil {
+		term.printf("Couldn't import %s: %v\n", args[0], err)
+		failures++
+		return
+	}
+
+	if len(args) == 2 {
+		if len(imported.requests) == 0 && len(imported.environments) == 1 {
+			imported.environments[0].name = args[1]
+		} else {
+			imported.name = args[1]
+		}
+	}
+
+	err = saveImport(term, config, imported)
+	if err != nil {
+		term.printf("Couldn't import %s: %v\n", args[0], err)
+		failures++
+	}
+}
+
+//
+// saveImport saves the imported requests into their collection, sets the collection's variables on the
+// active configuration and writes each environment out as a configuration of its own.
+//
+func saveImport(term console, config *configuration, imported *importedCollection) error {
+	for _, warning := range imported.warnings {
+		term.printf("%s\n", warning)
+	}
+
+	if len(imported.requests) > 0 {
+		coll, err := loadCollection(importedName(imported.name, defaultCollection))
+		if err != nil {
+			return err
+		}
+		for _, r := range imported.requests {
+			coll.put(r)
+		}
+		err = coll.write()
+		if err != nil {
+			return err
+		}
+		term.printf("Imported %d requests into the %s collection\n", len(imported.requests), coll.name)
+	}
+
+	if len(imported.variables) > 0 {
+		n := setImportedVariables(term, config.settings.Settings, imported.variables)
+		term.printf("Set %d settings on %s, use 'config save' to keep them\n", n, config.name)
+	}
+
+	for _, env := range imported.environments {
+		name, err := saveEnvironment(term, config, env)
+		if err != nil {
+			return fmt.Errorf("Couldn't save the %s environment: %v", env.name, err)
+		}
+		term.printf("Saved the %s environment as configuration %s\n", env.name, name)
+	}
+	return nil
+}
+
+//
+// setImportedVariables copies vars into settings, see importableVariables for those which are skipped.
+//
+func setImportedVariables(term console, settings map[string]string, vars []importedVariable) int {
+	vars = importableVariables(term, vars)
+	for _, v := range vars {
+		settings[v.key] = v.value
+	}
+	return len(vars)
+}
+
+//
+// importableVariables drops any variables named after one of acromantula's own settings, other than root,
+// as they'd change how the client behaves (a Postman timeout is in milliseconds, for one).
+//
+func importableVariables(term console, vars []importedVariable) []importedVariable {
+	var kept []importedVariable
+	for _, v := range vars {
+		if _, known := knownSettings[v.key]; known && v.key != "root" {
+			term.printf("%s is one of acromantula's own settings, skipping it\n", v.key)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
+}
+
+//
+// saveEnvironment writes env's variables into the configuration of the same name, creating it if need be.
+// Only the environment's variables are written, if it's the active configuration they're also set in
+// place (so they can be used straight away) without saving any other changes to it.
+//
+func saveEnvironment(term console, config *configuration, env importedEnvironment) (string, error) {
+	name := importedName(env.name, "imported")
+	path, err := getConfigPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := loadConfig(name, path)
+	if os.IsNotExist(err) {
+		target, err = defaultConfig(), nil
+		target.name = name
+	}
+	if err != nil {
+		return "", err
+	}
+
+	values := importableVariables(term, env.values)
+	for _, v := range values {
+		target.settings.Settings[v.key] = v.value
+		if config.name == name {
+			config.settings.Settings[v.key] = v.value
+		}
+	}
+
+	target.path = path
+	return name, target.writeConfig()
+}
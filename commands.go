@@ -28,7 +28,7 @@ type command interface {
 	// item (the top level command).
 	//
 	// Tokens will always be the comoplete slice of parsed tokens
-	exec(tokens []string, term *Term, config *configuration)
+	exec(tokens []string, term console, config *configuration)
 
 	usage() string
 
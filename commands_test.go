@@ -16,14 +16,34 @@ limitations under the License.
 
 package main
 
-import "testing"
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
 
 func TestBasicParse(t *testing.T) {
 	root := "https://example.com/"
 	token := "me"
 	expected := "https://example.com/me"
 
-	url, err := buildURL(root, token)
+	url, _, err := buildURL(root, token)
+	if err != nil {
+		t.Fatalf("Expected a nil error value!")
+	}
+
+	if url.String() != expected {
+		t.Fatalf("Expected %s, found %s", expected, url)
+	}
+}
+
+func TestHostPortURL(t *testing.T) {
+	root := "https://example.com/"
+	token := "localhost:8080/x?page=2"
+	expected := "http://localhost:8080/x?page=2"
+
+	url, _, err := buildURL(root, token)
 	if err != nil {
 		t.Fatalf("Expected a nil error value!")
 	}
@@ -38,7 +58,7 @@ func TestDoubleSlashes(t *testing.T) {
 	token := "/me"
 	expected := "https://example.com/me"
 
-	url, err := buildURL(root, token)
+	url, _, err := buildURL(root, token)
 	if err != nil {
 		t.Fatalf("Expected a nil error value!")
 	}
@@ -53,7 +73,7 @@ func TestNoSlashes(t *testing.T) {
 	token := "me"
 	expected := "https://example.com/me"
 
-	url, err := buildURL(root, token)
+	url, _, err := buildURL(root, token)
 	if err != nil {
 		t.Fatalf("Expected a nil error value!")
 	}
@@ -68,7 +88,7 @@ func TestAbsoluteURL(t *testing.T) {
 	token := "https://api.example.com"
 	expected := "https://api.example.com"
 
-	url, err := buildURL(root, token)
+	url, _, err := buildURL(root, token)
 	if err != nil {
 		t.Fatalf("Expected a nil error value!")
 	}
@@ -82,8 +102,37 @@ func TestNoURLs(t *testing.T) {
 	root := ""
 	token := ""
 
-	_, err := buildURL(root, token)
+	_, _, err := buildURL(root, token)
 	if err == nil {
 		t.Fatalf("Expected a non-nil error value!")
 	}
 }
+
+func TestRequestCommandParams(t *testing.T) {
+	var queries, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		queries = append(queries, r.URL.RawQuery)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	saved := config
+	defer func() { config = saved }()
+	config = defaultConfig()
+	config.settings.Settings["root"] = server.URL
+	config.settings.Params["page"] = "2"
+
+	term := &captureConsole{}
+	(&httpCommand{method: "GET"}).exec([]string{"get", "/x"}, term, config)
+	(&requestCommand{}).exec([]string{"request", "GET", "/x"}, term, config)
+	(&requestCommand{}).exec([]string{"request", "PROPFIND", "/x"}, term, config)
+
+	if len(queries) != 3 || queries[1] != queries[0] || bodies[1] != bodies[0] {
+		t.Fatalf("Expected request GET to send params like get, found %v and %v", queries, bodies)
+	}
+	if queries[0] != "page=2" || queries[2] != "" || bodies[2] != "page=2" {
+		t.Fatalf("Expected params in the query for GET and the body for PROPFIND, found %v and %v", queries, bodies)
+	}
+}
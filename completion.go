@@ -0,0 +1,200 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const keyTab = '\t'
+
+//
+// completer may optionally be implemented by a command to offer tab completion of its arguments.
+// tokens holds everything typed so far, the last token being the (possibly empty) one being completed.
+// The returned candidates are filtered by the caller, so they don't need to match the last token.
+//
+type completer interface {
+	complete(tokens []string) []string
+}
+
+// Commonly used request headers, offered when setting headers.
+var knownHeaders = []string{
+	"Accept",
+	"Accept-Charset",
+	"Accept-Encoding",
+	"Accept-Language",
+	"Authorization",
+	"Cache-Control",
+	"Connection",
+	"Content-Encoding",
+	"Content-Length",
+	"Content-Type",
+	"Cookie",
+	"Date",
+	"Expect",
+	"Forwarded",
+	"From",
+	"Host",
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+	"Max-Forwards",
+	"Origin",
+	"Pragma",
+	"Proxy-Authorization",
+	"Range",
+	"Referer",
+	"TE",
+	"User-Agent",
+	"Upgrade",
+	"Via",
+	"Warning",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Requested-With",
+}
+
+//
+// complete attempts to complete the token under the cursor.  A single candidate is filled in entirely,
+// multiple candidates are filled in as far as their common prefix, and are listed if that doesn't
+// get us any further.
+//
+func (t *Term) complete(line string, pos int) (string, int, bool) {
+	prefix := line[:pos]
+	tokens := splitForCompletion(prefix)
+	current := tokens[len(tokens)-1]
+
+	candidates := filterPrefix(completionCandidates(tokens), current)
+	if len(candidates) == 0 {
+		return line, pos, true
+	}
+
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") {
+		completion += " "
+	}
+
+	if completion == current {
+		t.term.Write([]byte(strings.Join(candidates, "  ") + "\n"))
+		return line, pos, true
+	}
+
+	newPrefix := prefix[:len(prefix)-len(current)] + completion
+	return newPrefix + line[pos:], len(newPrefix), true
+}
+
+//
+// completionCandidates returns everything that could be offered at the position of the last token.
+//
+func completionCandidates(tokens []string) []string {
+	if len(tokens) == 1 {
+		return sortCommands(commands)
+	}
+
+	cmd := commands[strings.ToLower(tokens[0])]
+	if c, ok := cmd.(completer); ok {
+		return c.complete(tokens)
+	}
+	return nil
+}
+
+//
+// splitForCompletion splits on whitespace, the result always has at least one token as the final
+// token is the one being completed (and is empty if the line ends with a space).
+//
+func splitForCompletion(line string) []string {
+	tokens := strings.Fields(line)
+	if len(line) == 0 || unicode.IsSpace(rune(line[len(line)-1])) {
+		tokens = append(tokens, "")
+	}
+	return tokens
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) && !seen[c] {
+			seen[c] = true
+			result = append(result, c)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func commonPrefix(candidates []string) string {
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+//
+// historyURLs returns every URL previously used with an HTTP command, along with each of their
+// parent paths so that completion can work a segment at a time.
+//
+func historyURLs(h *history) []string {
+	var urls []string
+	if h == nil {
+		return urls
+	}
+
+	for _, entry := range h.entries {
+		fields := strings.Fields(entry)
+		if len(fields) < 2 {
+			continue
+		}
+
+		urlField := fields[1]
+		switch commands[strings.ToLower(fields[0])].(type) {
+		case *httpCommand, *httpBodyCommand, *downloadCommand:
+		case *requestCommand:
+			if len(fields) < 3 {
+				continue
+			}
+			urlField = fields[2]
+		default:
+			continue
+		}
+
+		if !strings.HasPrefix(urlField, "/") && !strings.Contains(urlField, "://") {
+			continue
+		}
+
+		urls = append(urls, urlField)
+		start := strings.Index(urlField, "://")
+		if start >= 0 {
+			start += 3
+		}
+		for i := start + 1; i < len(urlField); i++ {
+			if urlField[i] == '/' {
+				urls = append(urls, urlField[:i+1])
+			}
+		}
+	}
+
+	return urls
+}
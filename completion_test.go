@@ -0,0 +1,102 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompletionCandidates(t *testing.T) {
+	initCommands(defaultConfig())
+
+	h := newHistory("", maxHistory)
+	h.add("get /users/1")
+	h.add("post https://api.example.com/items @data.json")
+	h.add("config list")
+	commandHistory = h
+	defer func() { commandHistory = newHistory("", maxHistory) }()
+
+	cases := []struct {
+		line     string
+		expected []string
+	}{
+		{"he", []string{"head", "header", "headers", "help"}},
+		{"headers ", []string{"set", "unset"}},
+		{"headers set Acc", []string{"Accept", "Accept-Charset", "Accept-Encoding", "Accept-Language"}},
+		{"config l", []string{"list", "load"}},
+		{"get /u", []string{"/users/", "/users/1"}},
+		{"put https://api", []string{"https://api.example.com/", "https://api.example.com/items"}},
+	}
+
+	for _, c := range cases {
+		tokens := splitForCompletion(c.line)
+		candidates := filterPrefix(completionCandidates(tokens), tokens[len(tokens)-1])
+		if len(candidates) != len(c.expected) {
+			t.Fatalf("Expected %v for '%v', found %v", c.expected, c.line, candidates)
+		}
+		for i := range candidates {
+			if candidates[i] != c.expected[i] {
+				t.Fatalf("Expected %v for '%v', found %v", c.expected, c.line, candidates)
+			}
+		}
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	if prefix := commonPrefix([]string{"header", "headers", "head"}); prefix != "head" {
+		t.Fatalf("Expected 'head', found '%v'", prefix)
+	}
+}
+
+func TestCompleteThenRun(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig, savedTerm := config, term
+	defer func() { config, term = savedConfig, savedTerm }()
+	config = defaultConfig()
+	config.settings.Settings["root"] = server.URL
+	term = &captureConsole{}
+	initCommands(config)
+
+	h := newHistory("", maxHistory)
+	h.add("get /items")
+	commandHistory = h
+	defer func() { commandHistory = newHistory("", maxHistory) }()
+
+	//
+	// Completing the only candidate adds a space after it, which mustn't become an empty item
+	//
+	line, _, _ := (&Term{}).complete("get /it", len("get /it"))
+	if line != "get /items " {
+		t.Fatalf("Expected the URL to be completed, found %q", line)
+	}
+
+	tokens, err := tokenize(line)
+	if err != nil || !runCommand(tokens) {
+		t.Fatalf("Expected the completed line to run, found %v (%v)", tokens, err)
+	}
+	if len(paths) != 1 || paths[0] != "/items" {
+		t.Fatalf("Expected a request for /items, found %v", paths)
+	}
+}
@@ -28,7 +28,7 @@ func (c *configurationCommand) usage() string {
 	return fmt.Sprintf("")
 }
 
-func (c *configurationCommand) exec(tokens []string, term *Term, config *configuration) {
+func (c *configurationCommand) exec(tokens []string, term console, config *configuration) {
 	//
 	// A 'config' by itself just prompts for the current configuration
 	//
@@ -48,6 +48,7 @@ func (c *configurationCommand) exec(tokens []string, term *Term, config *configu
 		configFile, err := getConfigPath(targetConfig)
 		if err != nil {
 			term.printf("Couldn't save %v: %v\n", targetConfig, err)
+			failures++
 			return
 		}
 
@@ -59,8 +60,10 @@ func (c *configurationCommand) exec(tokens []string, term *Term, config *configu
 		err = config.writeConfig()
 		if err != nil {
 			term.printf("Couldn't save %v: %v\n", targetConfig, err)
+			failures++
 			return
 		}
+		saveCookies(term, config)
 		updatePrompt()
 		initCommands(config)
 	case "list":
@@ -68,15 +71,18 @@ func (c *configurationCommand) exec(tokens []string, term *Term, config *configu
 	case "load":
 		if len(tokens) < 3 {
 			term.writeString("Please supply a configuration name as well, such as 'config load acro'\n")
+			failures++
 		} else {
 			configFile, err := getConfigPath(tokens[2])
 			if err != nil {
 				term.printf("Couldn't load %v: %v\n", tokens[2], err)
+				failures++
 				return
 			}
 			conf, err := loadConfig(tokens[2], configFile)
 			if err != nil {
 				term.printf("Couldn't load %v: %v\n", tokens[2], err)
+				failures++
 				return
 			}
 
@@ -86,8 +92,22 @@ func (c *configurationCommand) exec(tokens []string, term *Term, config *configu
 			config.settings = conf.settings
 			updatePrompt()
 			initCommands(config)
+			useCookies(term, config)
 		}
 	default:
 		term.printf("Unknown option '%s', try one of [save, list, load]\n", tokens[1])
+		failures++
 	}
 }
+
+func (c *configurationCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return []string{"save", "list", "load"}
+	}
+
+	if len(tokens) == 3 && (tokens[1] == "load" || tokens[1] == "save") {
+		names, _ := listConfigs(configRoot)
+		return names
+	}
+	return nil
+}
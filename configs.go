@@ -89,18 +89,36 @@ func printConfigs(configRoot string) {
 
 	if len(configRoot) == 0 {
 		term.writeString("Can't print configs, no config root defined\n")
+		failures++
+		return
 	}
 
-	files, err := ioutil.ReadDir(configRoot)
+	names, err := listConfigs(configRoot)
 	if err != nil {
 		term.printf("Couldn't list configurations: %s\n", err)
+		failures++
 		return
 	}
 
+	for _, configName := range names {
+		term.printf(" %v\n", configName)
+	}
+}
+
+// listConfigs returns the names of all configurations found in the config root.
+func listConfigs(configRoot string) ([]string, error) {
+
+	files, err := ioutil.ReadDir(configRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
 	for _, file := range files {
 		if filepath.Ext(file.Name()) == ".yml" {
-			configName := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
-			term.printf(" %v\n", configName)
+			names = append(names, strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())))
 		}
 	}
+
+	return names, nil
 }
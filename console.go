@@ -0,0 +1,342 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+//
+// textColor is one of the standard ANSI foreground colours.
+//
+type textColor byte
+
+const (
+	red     textColor = '1'
+	green   textColor = '2'
+	yellow  textColor = '3'
+	blue    textColor = '4'
+	magenta textColor = '5'
+	cyan    textColor = '6'
+)
+
+//
+// console is everything a command needs for input and output.  The interactive raw mode Term is
+// one implementation, plainConsole and captureConsole allow commands to be driven from scripts
+// and tests.
+//
+type console interface {
+	printf(str string, args ...interface{})
+	writeString(str string)
+	writeBytes(bytes []byte)
+
+	//
+	// Text attributes, these are no-ops when the output doesn't support them.
+	//
+	bright()
+	dim()
+	underscore()
+	foreground(c textColor)
+	reset()
+
+	// readline reads and tokenizes the next line of input
+	readline() ([]string, error)
+
+	// readRaw reads the next line of input as it is, showing prompt if input is interactive
+	readRaw(prompt string) (string, error)
+
+	setPrompt(prompt string)
+}
+
+//
+// plainConsole reads lines from any reader and writes to any writer.  Escape codes are only written if
+// the output is a terminal.
+//
+type plainConsole struct {
+	in     *bufio.Reader
+	out    io.Writer
+	colors bool
+}
+
+func newPlainConsole(in io.Reader, out io.Writer) *plainConsole {
+	c := &plainConsole{in: bufio.NewReader(in), out: out}
+	if f, ok := out.(*os.File); ok {
+		c.colors = terminal.IsTerminal(int(f.Fd()))
+	}
+	return c
+}
+
+func (c *plainConsole) printf(str string, args ...interface{}) {
+	fmt.Fprintf(c.out, str, args...)
+}
+
+func (c *plainConsole) writeString(str string) {
+	io.WriteString(c.out, str)
+}
+
+func (c *plainConsole) writeBytes(bytes []byte) {
+	c.out.Write(bytes)
+}
+
+func (c *plainConsole) escape(code byte) {
+	if c.colors {
+		c.out.Write([]byte{keyEscape, '[', '0', code, 'm'})
+	}
+}
+
+func (c *plainConsole) bright() {
+	c.escape('1')
+}
+
+func (c *plainConsole) dim() {
+	c.escape('2')
+}
+
+func (c *plainConsole) underscore() {
+	c.escape('4')
+}
+
+func (c *plainConsole) foreground(color textColor) {
+	if c.colors {
+		c.out.Write([]byte{keyEscape, '[', '3', byte(color), 'm'})
+	}
+}
+
+func (c *plainConsole) reset() {
+	c.escape('0')
+}
+
+func (c *plainConsole) readline() ([]string, error) {
+	str, err := c.in.ReadString('\n')
+	if err != nil && (err != io.EOF || len(str) == 0) {
+		return nil, err
+	}
+	return tokenizeLine(c, strings.TrimRight(str, "\r\n")), nil
+}
+
+func (c *plainConsole) readRaw(prompt string) (string, error) {
+	str, err := c.in.ReadString('\n')
+	if err != nil && (err != io.EOF || len(str) == 0) {
+		return "", err
+	}
+	return strings.TrimRight(str, "\r\n"), nil
+}
+
+func (c *plainConsole) setPrompt(prompt string) {
+}
+
+//
+// captureConsole keeps all output in memory and reads from a fixed list of input lines, it's
+// mostly useful for testing.
+//
+type captureConsole struct {
+	bytes.Buffer
+	input []string
+}
+
+func (c *captureConsole) printf(str string, args ...interface{}) {
+	fmt.Fprintf(c, str, args...)
+}
+
+func (c *captureConsole) writeString(str string) {
+	c.WriteString(str)
+}
+
+func (c *captureConsole) writeBytes(bytes []byte) {
+	c.Write(bytes)
+}
+
+func (c *captureConsole) bright()                    {}
+func (c *captureConsole) dim()                       {}
+func (c *captureConsole) underscore()                {}
+func (c *captureConsole) foreground(color textColor) {}
+func (c *captureConsole) reset()                     {}
+
+func (c *captureConsole) readline() ([]string, error) {
+	if len(c.input) == 0 {
+		return nil, io.EOF
+	}
+
+	line := c.input[0]
+	c.input = c.input[1:]
+	return tokenizeLine(c, line), nil
+}
+
+func (c *captureConsole) readRaw(prompt string) (string, error) {
+	if len(c.input) == 0 {
+		return "", io.EOF
+	}
+
+	line := c.input[0]
+	c.input = c.input[1:]
+	return line, nil
+}
+
+func (c *captureConsole) setPrompt(prompt string) {
+}
+
+//
+// tokenizeLine tokenizes str, reporting any error to the console as a failure and returning no tokens.
+//
+func tokenizeLine(term console, str string) []string {
+	// Comments aren't tokenized, so they may contain unbalanced quotes
+	if strings.HasPrefix(strings.TrimSpace(str), "#") {
+		return []string{strings.TrimSpace(str)}
+	}
+
+	tokens, err := tokenize(str)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+	}
+	return tokens
+}
+
+func tokenize(str string) ([]string, error) {
+
+	// Final tokenized set of strings.  5 is a pretty middle of the road choice
+	tokens := make([]string, 0, 5)
+
+	// Used to build the intermediate token
+	buffer := bytes.NewBuffer(make([]byte, 0, 0))
+
+	isDoubleQuoted := false
+	isSingleQuoted := false
+	isEscaped := false
+
+	// Whether the current token was quoted, so "" is kept as an empty token
+	isQuoted := false
+
+	// The number of empty, unquoted tokens at the end, left by trailing spaces
+	trailing := 0
+
+	for _, rune := range str {
+		//
+		// Everything within single quotes is taken literally, which saves escaping JSON bodies
+		//
+		if isSingleQuoted {
+			if rune == '\'' {
+				isSingleQuoted = false
+			} else {
+				buffer.WriteRune(rune)
+			}
+			continue
+		}
+
+		//
+		// If we are in escaped mode, write the previous character
+		// literally.
+		//
+		if isEscaped {
+			buffer.WriteRune(rune)
+			isEscaped = false
+			continue
+		}
+
+		char := fmt.Sprintf("%c", rune)
+
+		if char == "\\" {
+			isEscaped = true
+			continue
+		}
+
+		if char == "\"" {
+			isDoubleQuoted = !isDoubleQuoted
+			isQuoted = true
+			continue
+		}
+
+		//
+		// A single quote only starts a quoted value at the start of a token or an item's value
+		// (name='a b', Header:'x'), so apostrophes such as name=O'Brien are kept as they are.  Within
+		// a query they're left for the query's own strings, as in select(.name == 'bob').
+		//
+		if char == "'" && !isDoubleQuoted && opensQuote(buffer.String()) && !inQuery(tokens, buffer.String()) {
+			isSingleQuoted = true
+			isQuoted = true
+			continue
+		}
+
+		//
+		// We only care if we are not in double quotes
+		//
+		if unicode.IsSpace(rune) && !isDoubleQuoted {
+			if buffer.Len() == 0 && !isQuoted {
+				trailing++
+			} else {
+				trailing = 0
+			}
+			tokens = append(tokens, buffer.String())
+			buffer.Reset()
+			isQuoted = false
+		} else {
+			buffer.WriteRune(rune)
+		}
+
+	}
+
+	//
+	// At this point we should certainly be out of any quoted context
+	//
+	if isDoubleQuoted {
+		return []string{}, fmt.Errorf("Error, double quotes don't seem to match up")
+	}
+
+	if isSingleQuoted {
+		return []string{}, fmt.Errorf("Error, single quotes don't seem to match up")
+	}
+
+	//
+	// Push the remaining string, dropping the empty tokens left by trailing spaces (such as the
+	// one added after completing a URL)
+	//
+	if buffer.Len() > 0 || isQuoted {
+		tokens = append(tokens, buffer.String())
+	} else {
+		tokens = tokens[:len(tokens)-trailing]
+	}
+
+	return tokens, nil
+}
+
+func opensQuote(token string) bool {
+	return len(token) == 0 || strings.HasSuffix(token, "=") || strings.HasSuffix(token, ":")
+}
+
+//
+// inQuery determines if the token being read is part of a query, that's anything after a | token or
+// given to 'last query'.
+//
+func inQuery(tokens []string, current string) bool {
+	if strings.HasPrefix(current, "|") {
+		return true
+	}
+	for i, token := range tokens {
+		if strings.HasPrefix(token, "|") || (i == 1 && token == "query" && strings.EqualFold(tokens[0], "last")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens, err := tokenize(`header set Authorization "Bearer abc" \"x`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"header", "set", "Authorization", "Bearer abc", `"x`}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %v, found %v", expected, tokens)
+	}
+	for i := range expected {
+		if tokens[i] != expected[i] {
+			t.Fatalf("Expected %v, found %v", expected, tokens)
+		}
+	}
+
+	tokens, err = tokenize(`post /items '{"a": "b \\ c"}'`)
+	if err != nil || len(tokens) != 3 || tokens[2] != `{"a": "b \\ c"}` {
+		t.Fatalf("Expected single quotes to be taken literally, found %v (%v)", tokens, err)
+	}
+
+	tokens, err = tokenize(`post /x name=O'Brien q==don't note='it is' Header:'a b' bio:='"x"'`)
+	expected = []string{"post", "/x", "name=O'Brien", "q==don't", "note=it is", "Header:a b", `bio:="x"`}
+	if err != nil || strings.Join(tokens, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Expected %v, found %v (%v)", expected, tokens, err)
+	}
+
+	//
+	// Single quotes within a query are left for the query to read as strings
+	//
+	for line, query := range map[string]string{
+		`get /users | select(.name == 'bob') | .id`:  "select(.name == 'bob') | .id",
+		`get /users |.[] | select(.name=='O Brien')`: ".[] | select(.name=='O Brien')",
+	} {
+		tokens, err = tokenize(line)
+		if _, found := splitQuery(tokens); err != nil || found != query {
+			t.Fatalf("Expected the query %v, found %v (%v)", query, tokens, err)
+		}
+	}
+
+	tokens, err = tokenize(`last query select(.name == 'bob')`)
+	if err != nil || strings.Join(tokens[2:], " ") != "select(.name == 'bob')" {
+		t.Fatalf("Expected the quotes to be kept, found %v (%v)", tokens, err)
+	}
+
+	//
+	// Trailing spaces don't leave an empty token, though an empty quoted one is kept
+	//
+	for line, expected := range map[string]string{"get /x ": "get|/x", "get /x  ": "get|/x", `header set X "" `: "header|set|X|", "": ""} {
+		tokens, err = tokenize(line)
+		if err != nil || strings.Join(tokens, "|") != expected {
+			t.Fatalf("Expected %v for %q, found %v (%v)", expected, line, tokens, err)
+		}
+	}
+
+	for _, line := range []string{`get "/unterminated`, `post /items '{"a":1}`} {
+		if _, err = tokenize(line); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", line)
+		}
+	}
+}
+
+func TestCaptureConsole(t *testing.T) {
+	config := defaultConfig()
+	cmd := &mapCommand{desc: "test", backingMap: config.settings.Headers}
+	term := &captureConsole{input: []string{"headers set X-Test one", "headers"}}
+
+	for {
+		tokens, err := term.readline()
+		if err == io.EOF {
+			break
+		}
+		cmd.exec(tokens, term, config)
+	}
+
+	if !strings.Contains(term.String(), " X-Test => one\n") {
+		t.Fatalf("Expected X-Test in output, found %v", term.String())
+	}
+}
+
+func TestPlainConsoleNoEscapes(t *testing.T) {
+	out := new(bytes.Buffer)
+	term := newPlainConsole(strings.NewReader("get /one\nget /two"), out)
+
+	term.underscore()
+	term.writeString("text")
+	term.reset()
+
+	if out.String() != "text" {
+		t.Fatalf("Expected no escape codes, found %q", out.String())
+	}
+
+	for _, expected := range []string{"/one", "/two"} {
+		tokens, err := term.readline()
+		if err != nil || len(tokens) != 2 || tokens[1] != expected {
+			t.Fatalf("Expected %v, found %v (%v)", expected, tokens, err)
+		}
+	}
+
+	if _, err := term.readline(); err != io.EOF {
+		t.Fatalf("Expected EOF, found %v", err)
+	}
+}
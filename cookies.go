@@ -0,0 +1,481 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+	"gopkg.in/yaml.v2"
+)
+
+const cookiesExt = ".cookies"
+
+//
+// storedCookie is a single cookie as kept in the jar, and as persisted to disk.
+//
+type storedCookie struct {
+	Name     string    `yaml:"name"`
+	Value    string    `yaml:"value"`
+	Domain   string    `yaml:"domain"`
+	Path     string    `yaml:"path"`
+	Expires  time.Time `yaml:"expires,omitempty"`
+	Secure   bool      `yaml:"secure,omitempty"`
+	HTTPOnly bool      `yaml:"httpOnly,omitempty"`
+	HostOnly bool      `yaml:"hostOnly,omitempty"`
+}
+
+func (c *storedCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+//
+// cookieJar is an http.CookieJar which, unlike net/http/cookiejar, allows its contents to be
+// listed, edited and persisted.  Cookies are kept by domain.
+//
+type cookieJar struct {
+	mu      sync.Mutex
+	cookies map[string][]*storedCookie
+}
+
+func newCookieJar() *cookieJar {
+	return &cookieJar{cookies: make(map[string][]*storedCookie)}
+}
+
+// The jar in use by the client, this is replaced whenever a configuration is loaded.
+var cookies = newCookieJar()
+
+func (j *cookieJar) SetCookies(u *url.URL, received []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := canonicalHost(u.Host)
+	now := time.Now()
+
+	for _, c := range received {
+		stored := &storedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+		}
+
+		//
+		// A cookie may only be set for the request's host or one of its parent domains, but not for a
+		// public suffix such as com or co.uk.  A public suffix (or IP address) naming the host itself
+		// is treated as if there were no domain at all.
+		//
+		domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+		if len(domain) > 0 && (net.ParseIP(host) != nil || isPublicSuffix(domain)) {
+			if domain != host {
+				continue
+			}
+			domain = ""
+		}
+
+		if len(domain) == 0 {
+			stored.Domain = host
+			stored.HostOnly = true
+		} else if domainMatch(host, domain) {
+			stored.Domain = domain
+		} else {
+			continue
+		}
+
+		if len(stored.Path) == 0 || stored.Path[0] != '/' {
+			stored.Path = defaultCookiePath(u.Path)
+		}
+
+		if c.MaxAge < 0 {
+			stored.Expires = now
+		} else if c.MaxAge > 0 {
+			stored.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		} else if !c.Expires.IsZero() {
+			stored.Expires = c.Expires
+		}
+
+		j.store(stored, now)
+	}
+}
+
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := canonicalHost(u.Host)
+	path := u.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	now := time.Now()
+
+	var matched []*storedCookie
+	for domain, list := range j.cookies {
+		if !domainMatch(host, domain) {
+			continue
+		}
+		for _, c := range list {
+			if c.expired(now) || (c.HostOnly && host != domain) || (c.Secure && u.Scheme != "https") || !pathMatch(path, c.Path) {
+				continue
+			}
+			matched = append(matched, c)
+		}
+	}
+
+	// More specific paths are sent first
+	sort.SliceStable(matched, func(a, b int) bool {
+		return len(matched[a].Path) > len(matched[b].Path)
+	})
+
+	result := make([]*http.Cookie, len(matched))
+	for i, c := range matched {
+		result[i] = &http.Cookie{Name: c.Name, Value: c.Value}
+	}
+	return result
+}
+
+//
+// store adds or replaces a cookie with the same name, domain and path.  An expired cookie
+// simply removes any existing one.
+//
+func (j *cookieJar) store(c *storedCookie, now time.Time) {
+	list := j.cookies[c.Domain]
+	for i, existing := range list {
+		if existing.Name == c.Name && existing.Path == c.Path {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+
+	if !c.expired(now) {
+		list = append(list, c)
+	}
+
+	if len(list) == 0 {
+		delete(j.cookies, c.Domain)
+	} else {
+		j.cookies[c.Domain] = list
+	}
+}
+
+func (j *cookieJar) set(domain, name, value, path string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.store(&storedCookie{Name: name, Value: value, Domain: strings.ToLower(domain), Path: path}, time.Now())
+}
+
+//
+// remove deletes every cookie called name for the domain, returning the number removed.
+//
+func (j *cookieJar) remove(domain, name string) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	domain = strings.ToLower(domain)
+	kept := make([]*storedCookie, 0, len(j.cookies[domain]))
+	for _, c := range j.cookies[domain] {
+		if c.Name != name {
+			kept = append(kept, c)
+		}
+	}
+
+	removed := len(j.cookies[domain]) - len(kept)
+	if len(kept) == 0 {
+		delete(j.cookies, domain)
+	} else {
+		j.cookies[domain] = kept
+	}
+	return removed
+}
+
+//
+// clear removes all cookies for the domain, or every cookie if domain is empty.
+//
+func (j *cookieJar) clear(domain string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(domain) == 0 {
+		j.cookies = make(map[string][]*storedCookie)
+	} else {
+		delete(j.cookies, strings.ToLower(domain))
+	}
+}
+
+func (j *cookieJar) domains() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	domains := make([]string, 0, len(j.cookies))
+	for domain := range j.cookies {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+//
+// list returns the unexpired cookies for a domain, sorted by name.
+//
+func (j *cookieJar) list(domain string) []storedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var result []storedCookie
+	for _, c := range j.cookies[strings.ToLower(domain)] {
+		if !c.expired(now) {
+			result = append(result, *c)
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Name < result[b].Name
+	})
+	return result
+}
+
+func (j *cookieJar) write(path string) error {
+	var all []storedCookie
+	for _, domain := range j.domains() {
+		all = append(all, j.list(domain)...)
+	}
+
+	bytes, err := yaml.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(filepath.Dir(path), 0700)
+	return ioutil.WriteFile(path, bytes, 0600)
+}
+
+func loadCookieJar(path string) (*cookieJar, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []storedCookie
+	err = yaml.Unmarshal(bytes, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	jar := newCookieJar()
+	now := time.Now()
+	for i := range all {
+		jar.store(&all[i], now)
+	}
+	return jar, nil
+}
+
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+//
+// domainMatch determines if a cookie for domain may be sent to host, an IP address only matches itself.
+//
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain)
+}
+
+func isPublicSuffix(domain string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+//
+// cookiesPath determines where a configuration's cookies are persisted, next to its YAML file.
+//
+func cookiesPath(config *configuration) string {
+	if len(config.path) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(config.path, filepath.Ext(config.path)) + cookiesExt
+}
+
+func persistCookies(config *configuration) bool {
+	return boolSettingValue(config.settings.Settings, "persist-cookies", false)
+}
+
+//
+// useCookies gives the client a fresh jar for the configuration, loading any persisted cookies.
+//
+func useCookies(term console, config *configuration) {
+	cookies = newCookieJar()
+
+	if persistCookies(config) && len(cookiesPath(config)) > 0 {
+		jar, err := loadCookieJar(cookiesPath(config))
+		if err == nil {
+			cookies = jar
+		} else if !os.IsNotExist(err) {
+			term.printf("Couldn't load cookies: %v\n", err)
+			failures++
+		}
+	}
+
+	client.Jar = cookies
+}
+
+//
+// saveCookies writes out the jar if the configuration has persistence enabled.
+//
+func saveCookies(term console, config *configuration) {
+	if !persistCookies(config) || len(cookiesPath(config)) == 0 {
+		return
+	}
+
+	err := cookies.write(cookiesPath(config))
+	if err != nil {
+		term.printf("Couldn't save cookies: %v\n", err)
+		failures++
+	}
+}
+
+type cookiesCommand struct{}
+
+func (c *cookiesCommand) description() string {
+	return "Lists and edits the cookies sent with requests"
+}
+
+func (c *cookiesCommand) usage() string {
+	return "[<domain>] | [set <domain> <name> <value> [path]] | [delete <domain> <name>] | [clear [domain]]"
+}
+
+func (c *cookiesCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) == 1 {
+		for _, domain := range cookies.domains() {
+			printCookies(term, domain)
+		}
+		return
+	}
+
+	switch tokens[1] {
+	case "set":
+		if len(tokens) < 5 {
+			term.printf("Usage: %s set <domain> <name> <value> [path]\n", tokens[0])
+			failures++
+			return
+		}
+		path := "/"
+		if len(tokens) > 5 {
+			path = tokens[5]
+		}
+		cookies.set(tokens[2], tokens[3], tokens[4], path)
+	case "delete":
+		if len(tokens) < 4 {
+			term.printf("Usage: %s delete <domain> <name>\n", tokens[0])
+			failures++
+			return
+		}
+		if cookies.remove(tokens[2], tokens[3]) == 0 {
+			term.printf("No cookie '%s' found for %s\n", tokens[3], tokens[2])
+			failures++
+			return
+		}
+	case "clear":
+		domain := ""
+		if len(tokens) > 2 {
+			domain = tokens[2]
+		}
+		cookies.clear(domain)
+	default:
+		printCookies(term, tokens[1])
+		return
+	}
+
+	saveCookies(term, config)
+}
+
+func (c *cookiesCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return append([]string{"set", "delete", "clear"}, cookies.domains()...)
+	}
+
+	if len(tokens) == 3 && tokens[1] != "set" {
+		return cookies.domains()
+	}
+
+	if len(tokens) == 4 && tokens[1] == "delete" {
+		var names []string
+		for _, cookie := range cookies.list(tokens[2]) {
+			names = append(names, cookie.Name)
+		}
+		return names
+	}
+	return nil
+}
+
+func printCookies(term console, domain string) {
+	list := cookies.list(domain)
+	if len(list) == 0 {
+		return
+	}
+
+	term.printf(" %s\n", domain)
+	for _, cookie := range list {
+		attributes := fmt.Sprintf("Path=%s", cookie.Path)
+		if !cookie.Expires.IsZero() {
+			attributes += fmt.Sprintf("; Expires=%s", cookie.Expires.Format(time.RFC1123))
+		}
+		if cookie.Secure {
+			attributes += "; Secure"
+		}
+		if cookie.HTTPOnly {
+			attributes += "; HttpOnly"
+		}
+		term.printf("   %v => %v (%s)\n", cookie.Name, cookie.Value, attributes)
+	}
+}
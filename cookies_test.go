@@ -0,0 +1,140 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func cookieNames(jar *cookieJar, rawURL string) []string {
+	u, _ := url.Parse(rawURL)
+	var names []string
+	for _, c := range jar.Cookies(u) {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestCookieMatching(t *testing.T) {
+	jar := newCookieJar()
+	u, _ := url.Parse("https://api.example.com/v1/login")
+
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "secure", Value: "3", Path: "/", Secure: true},
+		{Name: "other", Value: "4", Domain: "other.com"},
+		{Name: "gone", Value: "5", MaxAge: -1},
+	})
+
+	if names := cookieNames(jar, "https://api.example.com/v1/users"); len(names) != 3 {
+		t.Fatalf("Expected host, domain and secure cookies, found %v", names)
+	}
+
+	if names := cookieNames(jar, "http://api.example.com/"); len(names) != 1 || names[0] != "domain" {
+		t.Fatalf("Expected only the domain cookie, found %v", names)
+	}
+
+	if names := cookieNames(jar, "https://www.example.com/v1/"); len(names) != 1 || names[0] != "domain" {
+		t.Fatalf("Expected only the domain cookie, found %v", names)
+	}
+
+	if len(jar.list("other.com")) != 0 {
+		t.Fatalf("Cookies for other domains should be rejected")
+	}
+}
+
+func TestCookieDomainLimits(t *testing.T) {
+	jar := newCookieJar()
+	u, _ := url.Parse("https://shop.example.co.uk/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "suffix", Value: "1", Domain: "co.uk"},
+		{Name: "tld", Value: "2", Domain: ".uk"},
+		{Name: "site", Value: "3", Domain: "example.co.uk"},
+	})
+	if names := cookieNames(jar, "https://other.co.uk/"); len(names) != 0 {
+		t.Fatalf("Cookies for a public suffix should be rejected, found %v", names)
+	}
+	if names := cookieNames(jar, "https://www.example.co.uk/"); len(names) != 1 || names[0] != "site" {
+		t.Fatalf("Expected only the site cookie, found %v", names)
+	}
+
+	//
+	// A public suffix naming the host itself is kept for just that host
+	//
+	u, _ = url.Parse("https://myapp.herokuapp.com/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "app", Value: "4", Domain: "herokuapp.com"}})
+	u, _ = url.Parse("https://localhost:8080/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "local", Value: "5", Domain: "localhost"}})
+	if names := cookieNames(jar, "https://other.herokuapp.com/"); len(names) != 0 {
+		t.Fatalf("Cookies for a public suffix should be rejected, found %v", names)
+	}
+	if names := cookieNames(jar, "http://localhost/"); len(names) != 1 || names[0] != "local" {
+		t.Fatalf("Expected a host only cookie for localhost, found %v", names)
+	}
+
+	u, _ = url.Parse("http://10.1.2.3/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "partial", Value: "6", Domain: "2.3"}, {Name: "ip", Value: "7", Domain: "10.1.2.3"}})
+	if names := cookieNames(jar, "http://10.1.2.3/"); len(names) != 1 || names[0] != "ip" {
+		t.Fatalf("Expected only the cookie for the whole IP address, found %v", names)
+	}
+	jar.set("2.3", "manual", "8", "/")
+	if names := cookieNames(jar, "http://10.1.2.3/"); len(names) != 1 {
+		t.Fatalf("Expected IP addresses not to match a partial address, found %v", names)
+	}
+}
+
+func TestCookieEditing(t *testing.T) {
+	jar := newCookieJar()
+	jar.set("example.com", "session", "abc", "/")
+	jar.set("example.com", "session", "def", "/")
+
+	list := jar.list("example.com")
+	if len(list) != 1 || list[0].Value != "def" {
+		t.Fatalf("Expected a single replaced cookie, found %v", list)
+	}
+
+	if jar.remove("example.com", "session") != 1 || len(jar.domains()) != 0 {
+		t.Fatalf("Expected the cookie to be removed")
+	}
+}
+
+func TestCookiePersistence(t *testing.T) {
+	file, _ := ioutil.TempFile("", "")
+	defer os.Remove(file.Name())
+
+	jar := newCookieJar()
+	jar.set("example.com", "session", "abc", "/")
+
+	err := jar.write(file.Name())
+	if err != nil {
+		t.Fatalf("Error on writing cookies: %v", err)
+	}
+
+	jar2, err := loadCookieJar(file.Name())
+	if err != nil {
+		t.Fatalf("Error on reading cookies: %v", err)
+	}
+
+	if names := cookieNames(jar2, "http://example.com/"); len(names) != 1 || names[0] != "session" {
+		t.Fatalf("Expected the session cookie, found %v", names)
+	}
+}
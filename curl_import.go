@@ -0,0 +1,748 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Given to import, shows the equivalent command rather than sending the request
+const dryRunFlag = "--dry-run"
+
+// Saves an imported curl command under a name rather than sending it
+const saveFlag = "--save"
+
+//
+// Short curl options are translated to their long form before being handled.
+//
+var curlShortOptions = map[byte]string{
+	'X': "--request",
+	'H': "--header",
+	'd': "--data",
+	'F': "--form",
+	'u': "--user",
+	'b': "--cookie",
+	'A': "--user-agent",
+	'e': "--referer",
+	'o': "--output",
+	'T': "--upload-file",
+	'k': "--insecure",
+	'I': "--head",
+	'G': "--get",
+	's': "--silent",
+	'S': "--show-error",
+	'L': "--location",
+	'v': "--verbose",
+	'i': "--include",
+	'f': "--fail",
+	'g': "--globoff",
+	'N': "--no-buffer",
+	'm': "--max-time",
+	'c': "--cookie-jar",
+	'w': "--write-out",
+	'x': "--proxy",
+}
+
+//
+// Long options which take a value, those not handled by parseCurl are ignored with a warning.
+//
+var curlValueOptions = map[string]bool{
+	"--request": true, "--header": true, "--data": true, "--data-ascii": true, "--data-raw": true,
+	"--data-binary": true, "--data-urlencode": true, "--form": true, "--form-string": true, "--user": true,
+	"--cookie": true, "--user-agent": true, "--referer": true, "--output": true, "--upload-file": true,
+	"--url": true, "--max-time": true, "--connect-timeout": true, "--cookie-jar": true, "--write-out": true,
+	"--proxy": true, "--retry": true, "--limit-rate": true, "--cacert": true, "--cert": true, "--key": true,
+}
+
+//
+// Options which make no difference to the request itself, so are dropped without a warning.
+//
+var curlIgnoredOptions = map[string]bool{
+	"--silent": true, "--show-error": true, "--location": true, "--verbose": true, "--include": true,
+	"--fail": true, "--globoff": true, "--no-buffer": true, "--http1.1": true, "--http2": true,
+	"--progress-bar": true, "--no-progress-meter": true,
+}
+
+//
+// curlRequest is a curl command line translated into a request spec.  curl's -k can't be expressed
+// as part of the spec, so it is kept alongside.
+//
+type curlRequest struct {
+	spec     *requestSpec
+	insecure bool
+	warnings []string
+}
+
+//
+// splitShellWords splits a command line the way a POSIX shell would, handling single, double and
+// $'...' quotes, backslash escapes and line continuations.
+//
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var word bytes.Buffer
+	inWord := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				if line[i] != '\n' {
+					word.WriteByte(line[i])
+					inWord = true
+				}
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("Single quotes don't match up")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '$' && i+1 < len(line) && line[i+1] == '\'':
+			n, err := readANSIQuoted(line[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 1
+			inWord = true
+		case c == '"':
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`\n", line[i+1]) >= 0 {
+					i++
+					if line[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(line[i])
+			}
+			if i == len(line) {
+				return nil, fmt.Errorf("Double quotes don't match up")
+			}
+			inWord = true
+		case unicode.IsSpace(rune(c)):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+//
+// readANSIQuoted decodes the contents of a $'...' string, returning how much of s was consumed
+// including the closing quote.
+//
+func readANSIQuoted(s string, word *bytes.Buffer) (int, error) {
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"', '0': 0, 'a': '\a',
+		'b': '\b', 'e': 0x1b, 'f': '\f', 'v': '\v'}
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				break
+			}
+			i++
+			if s[i] == 'x' || s[i] == 'u' {
+				digits := 2
+				if s[i] == 'u' {
+					digits = 4
+				}
+				if i+digits < len(s) {
+					if n, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32); err == nil {
+						if s[i] == 'x' {
+							word.WriteByte(byte(n))
+						} else {
+							word.WriteRune(rune(n))
+						}
+						i += digits
+						continue
+					}
+				}
+			}
+			if e, ok := escapes[s[i]]; ok {
+				word.WriteByte(e)
+			} else {
+				word.WriteByte('\\')
+				word.WriteByte(s[i])
+			}
+		default:
+			word.WriteByte(s[i])
+		}
+	}
+	return 0, fmt.Errorf("$' quotes don't match up")
+}
+
+//
+// parseCurl translates curl's arguments (with or without the leading 'curl') into a request.
+// Options that don't affect the request are ignored, anything unsupported produces a warning.
+//
+func parseCurl(args []string) (*curlRequest, error) {
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	result := &curlRequest{spec: &requestSpec{}}
+	spec := result.spec
+	method := ""
+	var data []curlDataOption
+	head, get, compressed := false, false, false
+
+	// flag handles options without a value, returning false for those that aren't known
+	flag := func(option string) bool {
+		switch option {
+		case "--insecure":
+			result.insecure = true
+		case "--head":
+			head = true
+		case "--get":
+			get = true
+		case "--compressed":
+			compressed = true
+		default:
+			return curlIgnoredOptions[option]
+		}
+		return true
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		option, value, hasValue := arg, "", false
+
+		switch {
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			option, value, hasValue = "--url", arg, true
+		case !strings.HasPrefix(arg, "--"):
+			//
+			// Short options may be bundled (-sSL), the last may take a value which can be attached (-XPOST)
+			//
+			option = ""
+			for j := 1; j < len(arg); j++ {
+				long, ok := curlShortOptions[arg[j]]
+				if ok && curlValueOptions[long] {
+					option = long
+					if j+1 < len(arg) {
+						value, hasValue = arg[j+1:], true
+					}
+					break
+				}
+				if !ok || !flag(long) {
+					result.warnings = append(result.warnings, fmt.Sprintf("Ignoring unsupported option -%c", arg[j]))
+				}
+			}
+			if len(option) == 0 {
+				continue
+			}
+		case !curlValueOptions[arg]:
+			if !flag(arg) {
+				result.warnings = append(result.warnings, fmt.Sprintf("Ignoring unsupported option %s", arg))
+			}
+			continue
+		}
+
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch option {
+		case "--url":
+			if len(spec.url) > 0 {
+				result.warnings = append(result.warnings, fmt.Sprintf("Only the first URL is used, ignoring %s", value))
+				continue
+			}
+			spec.url = value
+			if !strings.Contains(spec.url, "://") {
+				spec.url = "http://" + spec.url
+			}
+		case "--request":
+			method = strings.ToUpper(value)
+		case "--header":
+			name, headerValue := splitCurlHeader(value)
+			spec.items = append(spec.items, requestItem{kind: headerItem, key: name, value: headerValue})
+		case "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+			data = append(data, curlDataOption{option, value})
+		case "--form", "--form-string":
+			item, err := curlFormItem(option, value)
+			if err != nil {
+				return nil, err
+			}
+			spec.items = append(spec.items, *item)
+			spec.multipart = true
+		case "--user":
+			if !strings.Contains(value, ":") {
+				result.warnings = append(result.warnings, "No password was given with -u, using an empty one")
+			}
+			spec.items = append(spec.items, requestItem{kind: headerItem, key: "Authorization",
+				value: "Basic " + base64.StdEncoding.EncodeToString([]byte(value))})
+		case "--cookie":
+			if !strings.Contains(value, "=") {
+				result.warnings = append(result.warnings, fmt.Sprintf("Ignoring cookie file %s, only name=value cookies are supported", value))
+				continue
+			}
+			spec.items = append(spec.items, requestItem{kind: headerItem, key: "Cookie", value: value})
+		case "--user-agent":
+			spec.items = append(spec.items, requestItem{kind: headerItem, key: "User-Agent", value: value})
+		case "--referer":
+			spec.items = append(spec.items, requestItem{kind: headerItem, key: "Referer", value: value})
+		case "--output":
+			spec.output = value
+		case "--upload-file":
+			spec.bodyFile = value
+		default:
+			result.warnings = append(result.warnings, fmt.Sprintf("Ignoring unsupported option %s %s", option, value))
+		}
+	}
+
+	if len(spec.url) == 0 {
+		return nil, fmt.Errorf("No URL was found in the curl command")
+	}
+
+	//
+	// Responses are decompressed automatically, as long as Accept-Encoding is left for the client
+	// to set.  An explicit one (as browsers copy) could ask for encodings that can't be decoded.
+	//
+	if compressed {
+		spec.items = removeHeaderItems(spec.items, "Accept-Encoding")
+	}
+
+	if len(data) > 0 && (spec.multipart || len(spec.bodyFile) > 0) {
+		return nil, fmt.Errorf("-d can't be combined with -F or -T")
+	}
+
+	//
+	// A single --data-binary @file is streamed like acromantula's own @file, otherwise the data
+	// is read and joined with & as curl does
+	//
+	if len(data) == 1 && !get && data[0].isFile() {
+		spec.bodyFile = data[0].value[1:]
+	} else if len(data) > 0 {
+		var parts []string
+		for _, d := range data {
+			part, err := d.read()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+
+		if get {
+			values, err := url.ParseQuery(strings.Join(parts, "&"))
+			if err != nil {
+				return nil, fmt.Errorf("Couldn't use the data as a query: %v", err)
+			}
+			for k, vs := range values {
+				for _, v := range vs {
+					spec.items = append(spec.items, requestItem{kind: paramItem, key: k, value: v})
+				}
+			}
+		} else {
+			spec.body = strings.Join(parts, "&")
+		}
+	}
+
+	if !get && len(data) > 0 && !hasHeaderItem(spec.items, "Content-Type") {
+		spec.items = append(spec.items, requestItem{kind: headerItem, key: "Content-Type", value: "application/x-www-form-urlencoded"})
+	}
+
+	switch {
+	case len(method) > 0:
+		spec.method = method
+	case head:
+		spec.method = "HEAD"
+	case get:
+		spec.method = "GET"
+	case len(data) > 0 || spec.multipart:
+		spec.method = "POST"
+	case len(spec.bodyFile) > 0:
+		spec.method = "PUT"
+	default:
+		spec.method = "GET"
+	}
+
+	return result, nil
+}
+
+//
+// curlDataOption is one of the -d options, which are only read once all options are known.
+//
+type curlDataOption struct {
+	option string
+	value  string
+}
+
+func (d curlDataOption) isFile() bool {
+	return d.option == "--data-binary" && strings.HasPrefix(d.value, "@") && d.value != "@-"
+}
+
+//
+// splitCurlHeader splits 'Name: value', curl's 'Name;' is a header with an empty value.
+//
+func splitCurlHeader(header string) (string, string) {
+	if i := strings.IndexByte(header, ':'); i >= 0 {
+		return strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1:])
+	}
+	return strings.TrimSuffix(strings.TrimSpace(header), ";"), ""
+}
+
+//
+// read returns the data given by the option, reading it from a file for @file.
+//
+func (d curlDataOption) read() (string, error) {
+	option, value := d.option, d.value
+	switch option {
+	case "--data-raw":
+		return value, nil
+	case "--data-urlencode":
+		name, content := "", value
+		if i := strings.IndexAny(value, "=@"); i >= 0 {
+			name, content = value[:i], value[i+1:]
+			if value[i] == '@' {
+				data, err := readCurlFile(content)
+				if err != nil {
+					return "", err
+				}
+				content = data
+			}
+		}
+		if len(name) > 0 {
+			return name + "=" + url.QueryEscape(content), nil
+		}
+		return url.QueryEscape(content), nil
+	}
+
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+
+	data, err := readCurlFile(value[1:])
+	if err != nil {
+		return "", err
+	}
+
+	// Only --data-binary keeps the file's line breaks
+	if option != "--data-binary" {
+		data = strings.NewReplacer("\r", "", "\n", "").Replace(data)
+	}
+	return data, nil
+}
+
+func readCurlFile(path string) (string, error) {
+	if path == "-" {
+		return "", fmt.Errorf("Reading data from stdin isn't supported, save it to a file first")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %v: %v", path, err)
+	}
+	return string(data), nil
+}
+
+//
+// curlFormItem translates a -F field, name=@file is a file and name=<file is a field read from a file.
+//
+func curlFormItem(option, value string) (*requestItem, error) {
+	i := strings.IndexByte(value, '=')
+	if i <= 0 {
+		return nil, fmt.Errorf("'%s' isn't a valid form field, expected name=value", value)
+	}
+	name, content := value[:i], value[i+1:]
+
+	if option == "--form" && strings.HasPrefix(content, "@") {
+		path, contentType := content[1:], ""
+		for _, param := range strings.Split(path, ";")[1:] {
+			if strings.HasPrefix(param, "type=") {
+				contentType = param
+			}
+		}
+		if j := strings.IndexByte(path, ';'); j >= 0 {
+			path = path[:j]
+		}
+		if len(contentType) > 0 {
+			path += ";" + contentType
+		}
+		return &requestItem{kind: fileDataItem, key: name, value: path}, nil
+	}
+
+	if option == "--form" && strings.HasPrefix(content, "<") {
+		data, err := readCurlFile(content[1:])
+		if err != nil {
+			return nil, err
+		}
+		content = data
+	}
+	return &requestItem{kind: dataItem, key: name, value: content}, nil
+}
+
+func hasHeaderItem(items []requestItem, name string) bool {
+	for _, item := range items {
+		if item.kind == headerItem && strings.EqualFold(item.key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeHeaderItems(items []requestItem, name string) []requestItem {
+	var kept []requestItem
+	for _, item := range items {
+		if item.kind != headerItem || !strings.EqualFold(item.key, name) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+//
+// commandLine is the acromantula command equivalent to spec.  Bodies which can't be given inline
+// are pasted, so the result may span several lines.
+//
+func (s *requestSpec) commandLine() string {
+	words := []string{"request", s.method, quoteToken(s.url)}
+	switch s.method {
+	case "GET", "HEAD", "DELETE", "OPTIONS", "POST", "PUT", "PATCH":
+		words = []string{strings.ToLower(s.method), quoteToken(s.url)}
+	}
+
+	if len(s.bodyFile) > 0 {
+		words = append(words, quoteToken("@"+s.bodyFile))
+	}
+
+	for _, item := range s.items {
+		words = append(words, quoteToken(item.String()))
+	}
+
+	if s.multipart {
+		words = append(words, multipartFlag)
+	}
+
+	paste := ""
+	if len(s.body) > 0 {
+		if isInlineBody(s.body) && !strings.ContainsAny(s.body, "\r\n") {
+			words = append(words, quoteToken(s.body))
+		} else {
+			sentinel := "END"
+			for strings.Contains("\n"+s.body+"\n", "\n"+sentinel+"\n") {
+				sentinel += "_"
+			}
+			words = append(words, pastePrefix+sentinel)
+			paste = "\n" + s.body + "\n" + sentinel
+		}
+	}
+
+	if len(s.query) > 0 {
+		words = append(words, "|", s.query)
+	} else if len(s.output) > 0 {
+		words = append(words, ">", quoteToken(s.output))
+	}
+
+	return strings.Join(words, " ") + paste
+}
+
+//
+// quoteToken quotes a token if needed, so that tokenize gives back the original.
+//
+func quoteToken(token string) string {
+	if len(token) > 0 && !strings.ContainsAny(token, " \t\r\n'\"\\") {
+		return token
+	}
+	if !strings.Contains(token, "'") {
+		return "'" + token + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(token) + `"`
+}
+
+type importCommand struct{}
+
+func (c *importCommand) description() string {
+	return "Imports requests from other tools, either a curl command or a Postman or Insomnia export"
+}
+
+func (c *importCommand) usage() string {
+	return "curl [--dry-run | --save <name>] '<curl command>' | curl [--dry-run | --save <name>] <<END | postman <file> [name] | insomnia <file> [name]"
+}
+
+func (c *importCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) < 3 {
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	switch tokens[1] {
+	case "curl":
+		importCurl(tokens[2:], term, config)
+	case "postman":
+		importFile(tokens[2:], term, config, parsePostman)
+	case "insomnia":
+		importFile(tokens[2:], term, config, parseInsomnia)
+	default:
+		term.printf("Don't know how to import '%s', try one of [curl, postman, insomnia]\n", tokens[1])
+		failures++
+	}
+}
+
+func (c *importCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return []string{"curl", "postman", "insomnia"}
+	}
+	if len(tokens) == 3 && tokens[1] == "curl" {
+		return []string{dryRunFlag, saveFlag}
+	}
+	if len(tokens) == 4 && tokens[1] == "curl" && tokens[2] == saveFlag {
+		return savedRequestNames(config)
+	}
+	return nil
+}
+
+//
+// importCurl runs a curl command through acromantula, or saves it as a named request.  The command
+// may be given as a single quoted token, as separate tokens, or pasted over several lines (as copied
+// from a browser).
+//
+func importCurl(args []string, term console, config *configuration) {
+	dryRun := false
+	saveAs := ""
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == dryRunFlag:
+			dryRun = true
+		case args[i] == saveFlag:
+			if i+1 == len(args) {
+				term.printf("%s must be followed by the name to save the request as\n", saveFlag)
+				failures++
+				return
+			}
+			saveAs = args[i+1]
+			i++
+		default:
+			kept = append(kept, args[i])
+		}
+	}
+	args = kept
+
+	collectionName, path := splitRequestName(config, saveAs)
+	if len(saveAs) > 0 {
+		if err := validRequestPath(path); err != nil {
+			term.printf("%v\n", err)
+			failures++
+			return
+		}
+	}
+
+	var err error
+	switch {
+	case len(args) > 0 && strings.HasPrefix(args[0], pastePrefix):
+		sentinel := strings.TrimPrefix(args[0], pastePrefix)
+		if len(sentinel) == 0 && len(args) > 1 {
+			sentinel = args[1]
+		}
+		if len(sentinel) == 0 {
+			err = fmt.Errorf("%s must be followed by a line to end the command with", pastePrefix)
+			break
+		}
+
+		var pasted string
+		pasted, err = readPastedBody(term, sentinel)
+		if err == nil {
+			args, err = splitShellWords(pasted)
+		}
+	case len(args) == 1:
+		args, err = splitShellWords(args[0])
+	}
+
+	var imported *curlRequest
+	if err == nil {
+		imported, err = parseCurl(args)
+	}
+	if err != nil {
+		term.printf("Couldn't import the curl command: %v\n", err)
+		failures++
+		return
+	}
+
+	for _, warning := range imported.warnings {
+		term.printf("%s\n", warning)
+	}
+	rememberSpec(imported.spec)
+
+	if dryRun || len(saveAs) > 0 {
+		if dryRun {
+			term.printf("%s\n", imported.spec.commandLine())
+		} else {
+			saveSpec(term, collectionName, path, imported.spec)
+		}
+		if imported.insecure {
+			term.writeString("# curl's -k skips certificate checks, use 'settings set insecure true' to do the same\n")
+		}
+		return
+	}
+
+	request, err := imported.spec.build(config, false)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+	rememberBody(imported.spec)
+
+	//
+	// -k only applies to this request, the configuration is put back as it was afterwards
+	//
+	if imported.insecure {
+		saved, ok := config.settings.Settings["insecure"]
+		config.settings.Settings["insecure"] = "true"
+		defer func() {
+			if ok {
+				config.settings.Settings["insecure"] = saved
+			} else {
+				delete(config.settings.Settings, "insecure")
+			}
+		}()
+	}
+
+	err = doRequest(term, request, imported.spec.options())
+	if err != nil {
+		term.printf("Error performing %s: %v\n", request.Method, err)
+		failures++
+	}
+}
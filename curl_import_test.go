@@ -0,0 +1,171 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	line := "curl 'https://example.com/a b' \\\n  -H \"X-Quote: \\\"hi\\\"\" --data-binary $'line\\none\\u00e9' plain\\ word"
+	words, err := splitShellWords(line)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"curl", "https://example.com/a b", "-H", `X-Quote: "hi"`, "--data-binary", "line\noneé", "plain word"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Fatalf("Expected %q, found %q", expected, words)
+	}
+
+	for _, line := range []string{"curl 'open", `curl "open`, "curl $'open"} {
+		if _, err := splitShellWords(line); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", line)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	upload := filepath.Join(dir, "upload.bin")
+	ioutil.WriteFile(upload, []byte("binary"), 0644)
+
+	words, _ := splitShellWords(`curl -sSLk -XPATCH example.com/items -H 'Accept: application/json' ` +
+		`-H 'Accept-Encoding: gzip, br' -d 'a=1' -d b=2 -u bob:secret -b 'session=abc' --compressed --frobnicate`)
+	imported, err := parseCurl(words)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	spec := imported.spec
+	if spec.method != "PATCH" || spec.url != "http://example.com/items" || spec.body != "a=1&b=2" || !imported.insecure {
+		t.Fatalf("Unexpected request %+v", spec)
+	}
+	if len(imported.warnings) != 1 || !strings.Contains(imported.warnings[0], "--frobnicate") {
+		t.Fatalf("Expected a warning for --frobnicate, found %v", imported.warnings)
+	}
+
+	headers := map[string]string{}
+	for _, item := range spec.items {
+		headers[item.key] = item.value
+	}
+	expected := map[string]string{"Accept": "application/json", "Authorization": "Basic Ym9iOnNlY3JldA==",
+		"Cookie": "session=abc", "Content-Type": "application/x-www-form-urlencoded"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Fatalf("Expected headers %v, found %v", expected, headers)
+	}
+
+	imported, _ = parseCurl([]string{"curl", "https://example.com/up", "--data-binary", "@" + upload})
+	if imported.spec.method != "POST" || imported.spec.bodyFile != upload {
+		t.Fatalf("Expected the file to be streamed, found %+v", imported.spec)
+	}
+
+	imported, _ = parseCurl([]string{"https://example.com/search", "-G", "-d", "q=acro", "--data-urlencode", "tag=a b"})
+	if imported.spec.method != "GET" || len(imported.spec.body) > 0 || len(imported.spec.items) != 2 {
+		t.Fatalf("Expected -G to move the data to the query, found %+v", imported.spec)
+	}
+
+	imported, _ = parseCurl([]string{"https://example.com/form", "-F", "title=Q1", "-F", "doc=@" + upload + ";type=text/plain"})
+	if imported.spec.method != "POST" || !imported.spec.multipart || imported.spec.items[1].value != upload+";type=text/plain" {
+		t.Fatalf("Expected a multipart request, found %+v", imported.spec)
+	}
+
+	for _, args := range [][]string{{"-X", "POST"}, {"https://example.com", "-H"}, {"https://example.com", "-d", "a", "-F", "b=c"}} {
+		if _, err := parseCurl(args); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", args)
+		}
+	}
+}
+
+func TestCurlCommandLine(t *testing.T) {
+	imported, _ := parseCurl([]string{"https://example.com/items", "-H", "X-Name: it's", "-d", `{"a": 1}`, "-o", "out.json"})
+	line := imported.spec.commandLine()
+	if line != `post https://example.com/items "X-Name:it's" Content-Type:application/x-www-form-urlencoded '{"a": 1}' > out.json` {
+		t.Fatalf("Unexpected command line %v", line)
+	}
+
+	tokens, _ := tokenize(line)
+	spec, err := parseRequestTokens("POST", tokens[1:])
+	if err != nil || spec.body != `{"a": 1}` || spec.output != "out.json" || spec.items[0].value != "it's" {
+		t.Fatalf("Expected the command line to parse back to the same request, found %+v (%v)", spec, err)
+	}
+
+	imported, _ = parseCurl([]string{"https://example.com/notes", "-d", "x=1"})
+	if line := imported.spec.commandLine(); !strings.HasSuffix(line, " <<END\nx=1\nEND") {
+		t.Fatalf("Expected a pasted body, found %v", line)
+	}
+}
+
+func TestImportCurl(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config = defaultConfig()
+
+	capture := &captureConsole{input: []string{"curl '" + server.URL + "/login' \\", "  -H 'Content-Type: application/json' \\",
+		`  --data-raw '{"user":"bob"}'`, "END"}}
+	cmd := &importCommand{}
+	before := failures
+	cmd.exec([]string{"import", "curl", "<<END"}, capture, config)
+
+	if failures != before || received == nil {
+		t.Fatalf("Expected the request to be sent, found %v", capture.String())
+	}
+	if received.Method != "POST" || received.URL.Path != "/login" || string(body) != `{"user":"bob"}` ||
+		received.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected request %v %v %s", received.Method, received.URL, body)
+	}
+
+	received = nil
+	capture = &captureConsole{}
+	cmd.exec([]string{"import", "curl", "--dry-run", "curl -I " + server.URL}, capture, config)
+	if received != nil || !strings.Contains(capture.String(), "head "+server.URL) {
+		t.Fatalf("Expected only the command to be shown, found %v", capture.String())
+	}
+
+	//
+	// --save keeps the imported request in the active collection rather than sending it
+	//
+	defer useTempConfigRoot()()
+	cmd.exec([]string{"import", "curl", "--save", "auth/login", "curl -X PUT " + server.URL + "/login -H 'X-Test: 1'"}, capture, config)
+	coll, _ := loadCollection(activeCollection(config))
+	saved := coll.find("auth/login")
+	if failures != before || received != nil || saved == nil || saved.Method != "PUT" || saved.URL != server.URL+"/login" {
+		t.Fatalf("Expected the request to be saved without sending it, found %+v (%v)", saved, capture.String())
+	}
+
+	cmd.exec([]string{"import", "curl", "curl " + server.URL, "--save"}, capture, config)
+	if failures != before+1 || received != nil {
+		t.Fatalf("Expected a failure for --save without a name")
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressWidth = 30
+const progressInterval = 100 * time.Millisecond
+
+//
+// Where a content type has several extensions, these are the ones picked for downloads.
+//
+var preferredExtensions = map[string]string{
+	"application/octet-stream": "bin",
+	"audio/mpeg":               "mp3",
+	"image/jpeg":               "jpg",
+	"image/tiff":               "tiff",
+	"text/html":                "html",
+	"text/plain":               "txt",
+	"video/mpeg":               "mpg",
+}
+
+//
+// extensionFor looks up contentTypes in reverse, returning "" if the type is unknown.  Without a
+// preference the shortest extension is used, so that results are predictable.
+//
+func extensionFor(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	if ext, ok := preferredExtensions[mediaType]; ok {
+		return ext
+	}
+
+	var exts []string
+	for ext, t := range contentTypes {
+		if t == mediaType {
+			exts = append(exts, ext)
+		}
+	}
+	sort.Slice(exts, func(a, b int) bool {
+		if len(exts[a]) != len(exts[b]) {
+			return len(exts[a]) < len(exts[b])
+		}
+		return exts[a] < exts[b]
+	})
+
+	if len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+//
+// nameFromURL is the last segment of the URL's path, or "" if there isn't one.
+//
+func nameFromURL(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+//
+// downloadName decides on a file name for a download that wasn't given one, preferring the server's
+// Content-Disposition and adding an extension based on the Content-Type if the name lacks one.  A name
+// that was given is used as it is.
+//
+func downloadName(name string, response *http.Response) string {
+	if len(name) > 0 {
+		return name
+	}
+
+	_, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition"))
+	if err == nil && len(params["filename"]) > 0 {
+		name = filepath.Base(params["filename"])
+	} else if response.Request != nil {
+		name = nameFromURL(response.Request.URL)
+	}
+
+	if len(name) == 0 {
+		name = "download"
+	}
+
+	if len(filepath.Ext(name)) == 0 {
+		if ext := extensionFor(response.Header.Get("Content-Type")); len(ext) > 0 {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+//
+// isComplete determines if a resumed download was already complete, in which case the server
+// can't satisfy the range requested.
+//
+func isComplete(response *http.Response, options responseOptions) bool {
+	return options.download && response.StatusCode == http.StatusRequestedRangeNotSatisfiable
+}
+
+//
+// saveResponse streams the response body to the file named in options, showing progress as it goes,
+// and returns the file's name.  Partial content for a download is appended to what is already there.
+//
+func saveResponse(term console, response *http.Response, options responseOptions) (string, error) {
+	name := options.output
+	if options.download {
+		name = downloadName(name, response)
+	}
+
+	if isComplete(response, options) {
+		term.printf("\n%s is already complete\n", name)
+		return name, nil
+	}
+
+	//
+	// Partial content is only appended if it starts where the file ends, any other response
+	// (such as a 200 from a server that ignored the Range) replaces the file
+	//
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	var offset int64
+	if options.download && response.StatusCode == http.StatusPartialContent {
+		if info, err := os.Stat(name); err == nil {
+			offset = info.Size()
+		}
+		start, err := rangeStart(response.Header.Get("Content-Range"))
+		if err != nil {
+			return "", err
+		}
+		if start != offset {
+			return "", fmt.Errorf("the server resumed at byte %d, but %s has %d bytes", start, name, offset)
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	total := response.ContentLength
+	if total >= 0 {
+		total += offset
+	}
+
+	term.writeString("\n")
+	progress := &progressWriter{term: term, written: offset, total: total}
+	_, err = io.Copy(io.MultiWriter(file, progress), response.Body)
+	progress.finish()
+	if err != nil {
+		return name, err
+	}
+
+	if offset > 0 {
+		term.printf("Resumed %s at %s, saved %s\n", name, formatSize(offset), formatSize(progress.written))
+	} else {
+		term.printf("Saved %s to %s\n", formatSize(progress.written), name)
+	}
+	return name, nil
+}
+
+//
+// rangeStart is the first byte of a Content-Range, as in 'bytes 4000-9999/10000'.
+//
+func rangeStart(contentRange string) (int64, error) {
+	var start, end int64
+	var total string
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total)
+	if err != nil {
+		return 0, fmt.Errorf("bad Content-Range '%s' for partial content", contentRange)
+	}
+	return start, nil
+}
+
+//
+// progressWriter counts the bytes written through it, redrawing a progress bar at most every
+// progressInterval.  Uploads are written from the transport's goroutine, hence the lock.
+//
+type progressWriter struct {
+	mu      sync.Mutex
+	term    console
+	written int64
+	total   int64 // -1 if unknown
+	drawn   time.Time
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.written += int64(len(data))
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+	return len(data), nil
+}
+
+func (p *progressWriter) draw() {
+	p.drawn = time.Now()
+
+	if p.total <= 0 {
+		p.term.printf("\r %s", formatSize(p.written))
+		return
+	}
+
+	done := int(p.written * progressWidth / p.total)
+	if done > progressWidth {
+		done = progressWidth
+	}
+	bar := strings.Repeat("=", done) + strings.Repeat(" ", progressWidth-done)
+	p.term.printf("\r [%s] %3d%%  %s / %s", bar, p.written*100/p.total, formatSize(p.written), formatSize(p.total))
+}
+
+func (p *progressWriter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.draw()
+	p.term.writeString("\n")
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	size := float64(n)
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		size /= unit
+		if size < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f %s", size, suffix)
+		}
+	}
+	return ""
+}
+
+type downloadCommand struct{}
+
+func (c *downloadCommand) description() string {
+	return "Downloads a file, resuming it if part of it is already there"
+}
+
+func (c *downloadCommand) usage() string {
+	return "<url> [Header:value] [param==value] [> file]"
+}
+
+func (c *downloadCommand) exec(tokens []string, term console, config *configuration) {
+	spec, err := parseRequestTokens("GET", tokens[1:])
+	if err != nil || len(spec.url) == 0 || spec.hasBody() || len(spec.query) > 0 {
+		if err != nil {
+			term.printf("%v\n", err)
+		}
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	request, err := spec.build(config, false)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	//
+	// If the file is already there, whether it was named or is the URL's, ask for just the rest of it.
+	// Otherwise a name that wasn't given is left to downloadName, once the response is in.
+	//
+	options := responseOptions{output: spec.output, download: true}
+	name := spec.output
+	if len(name) == 0 {
+		name = nameFromURL(request.URL)
+	}
+	if info, err := os.Stat(name); len(name) > 0 && err == nil && info.Size() > 0 {
+		options.output = name
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	}
+
+	err = doRequest(term, request, options)
+	if err != nil {
+		term.printf("Error downloading: %v\n", err)
+		failures++
+	}
+}
+
+func (c *downloadCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return historyURLs(commandHistory)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtensionFor(t *testing.T) {
+	expected := map[string]string{
+		"application/pdf":          "pdf",
+		"image/jpeg":               "jpg",
+		"text/html; charset=utf-8": "html",
+		"application/json":         "json",
+		"application/x-unknown":    "",
+		"":                         "",
+	}
+
+	for contentType, ext := range expected {
+		if found := extensionFor(contentType); found != ext {
+			t.Fatalf("Expected '%v' for %v, found '%v'", ext, contentType, found)
+		}
+	}
+}
+
+func TestDownloadName(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/reports/42", nil)
+	response := &http.Response{Header: http.Header{}, Request: req}
+	response.Header.Set("Content-Type", "application/pdf")
+
+	if name := downloadName("", response); name != "42.pdf" {
+		t.Fatalf("Expected 42.pdf, found %v", name)
+	}
+
+	response.Header.Set("Content-Disposition", `attachment; filename="../annual.pdf"`)
+	if name := downloadName("", response); name != "annual.pdf" {
+		t.Fatalf("Expected annual.pdf, found %v", name)
+	}
+
+	for _, supplied := range []string{"mine.dat", "report"} {
+		if name := downloadName(supplied, response); name != supplied {
+			t.Fatalf("Expected the supplied name to be kept, found %v", name)
+		}
+	}
+}
+
+func TestSplitOutput(t *testing.T) {
+	tokens, output := splitOutput([]string{"/report", ">", "report.pdf"})
+	if len(tokens) != 1 || output != "report.pdf" {
+		t.Fatalf("Expected 1 token and report.pdf, found %v and %v", tokens, output)
+	}
+
+	tokens, output = splitOutput([]string{"/report", "Accept:*/*", ">report.pdf"})
+	if len(tokens) != 2 || output != "report.pdf" {
+		t.Fatalf("Expected 2 tokens and report.pdf, found %v and %v", tokens, output)
+	}
+
+	if _, err := parseRequestTokens("GET", []string{"/report", "|", ".a", ">", "a.json"}); err == nil {
+		t.Fatalf("Expected a non-nil error value for a query with output!")
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config = defaultConfig()
+	capture := &captureConsole{}
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data.bin")
+
+	get := &httpCommand{method: "GET"}
+	get.exec([]string{"get", server.URL + "/data.bin", ">", file}, capture, config)
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) {
+		t.Fatalf("Expected the whole body to be saved, found %d bytes", len(data))
+	}
+	if lastResponse == nil || lastResponse.statusCode != http.StatusOK || lastResponse.body != nil {
+		t.Fatalf("Expected the response to be recorded without its body, found %+v", lastResponse)
+	}
+
+	os.Truncate(file, 4000)
+	download := &downloadCommand{}
+	download.exec([]string{"download", server.URL + "/data.bin", ">", file}, capture, config)
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) {
+		t.Fatalf("Expected the download to be resumed, found %d bytes", len(data))
+	}
+	if lastResponse.statusCode != http.StatusPartialContent || !strings.Contains(capture.String(), "Resumed") {
+		t.Fatalf("Expected partial content, found %v", lastResponse.status)
+	}
+
+	before := failures
+	download.exec([]string{"download", server.URL + "/data.bin", ">", file}, capture, config)
+	if failures != before || !strings.Contains(capture.String(), "already complete") {
+		t.Fatalf("Expected the download to already be complete, found %v", capture.String())
+	}
+}
+
+func TestStreamedDownloadTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/late" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("0123456789"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config = defaultConfig()
+	config.settings.Settings["timeout"] = "100ms"
+	capture := &captureConsole{}
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "slow.txt")
+
+	//
+	// The body takes longer than the timeout, but only the wait for the headers is bounded
+	//
+	before := failures
+	get := &httpCommand{method: "GET"}
+	get.exec([]string{"get", server.URL + "/slow", ">", file}, capture, config)
+	if data, _ := ioutil.ReadFile(file); failures != before || len(data) != 50 {
+		t.Fatalf("Expected the whole body to be saved, found %d bytes: %v", len(data), capture.String())
+	}
+
+	get.exec([]string{"get", server.URL + "/late", ">", file}, capture, config)
+	if failures == before || !strings.Contains(capture.String(), "no response within 100ms") {
+		t.Fatalf("Expected the late headers to time out, found %v", capture.String())
+	}
+}
+
+func TestDownloadResumeChecks(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	var contentRange string
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		switch r.URL.Path {
+		case "/ignored":
+			w.Write(content)
+		case "/wrong":
+			w.Header().Set("Content-Range", contentRange)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[:10])
+		default:
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer server.Close()
+
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config = defaultConfig()
+	capture := &captureConsole{}
+	download := &downloadCommand{}
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "report")
+
+	//
+	// A file without an extension is resumed too
+	//
+	ioutil.WriteFile(file, content[:4000], 0644)
+	download.exec([]string{"download", server.URL + "/report", ">", file}, capture, config)
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) || ranges[0] != "bytes=4000-" {
+		t.Fatalf("Expected the download to be resumed, found %d bytes for %v", len(data), ranges)
+	}
+
+	//
+	// A server ignoring the Range sends everything, which replaces the file
+	//
+	os.Truncate(file, 4000)
+	download.exec([]string{"download", server.URL + "/ignored", ">", file}, capture, config)
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, content) {
+		t.Fatalf("Expected the file to be rewritten, found %d bytes", len(data))
+	}
+
+	//
+	// Partial content that doesn't start where the file ends isn't appended
+	//
+	os.Truncate(file, 4000)
+	for _, contentRange = range []string{"bytes 0-9/10000", "10"} {
+		before := failures
+		download.exec([]string{"download", server.URL + "/wrong", ">", file}, capture, config)
+		if info, _ := os.Stat(file); failures == before || info.Size() != 4000 {
+			t.Fatalf("Expected %q to be rejected, found %d bytes: %v", contentRange, info.Size(), capture.String())
+		}
+	}
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Given to export, hides credentials in the exported request
+const redactFlag = "--redact"
+
+// Replaces the value of redacted headers
+const redacted = "REDACTED"
+
+// Headers hidden by --redact
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+//
+// exporter renders a request (whose body has already been read) as a command or program for
+// another tool.
+//
+type exporter struct {
+	name   string
+	render func(req *http.Request, body []byte) string
+}
+
+var exporters = []exporter{
+	{"curl", exportCurl},
+	{"httpie", exportHTTPie},
+	{"wget", exportWget},
+	{"go", exportGo},
+}
+
+func exporterNames() []string {
+	names := make([]string, len(exporters))
+	for i, e := range exporters {
+		names[i] = e.name
+	}
+	return names
+}
+
+func exporterNamed(name string) *exporter {
+	for i := range exporters {
+		if exporters[i].name == strings.ToLower(name) {
+			return &exporters[i]
+		}
+	}
+	return nil
+}
+
+//
+// exportRequest reads the request's body and renders it with the named exporter.  Only text bodies
+// can be exported, as they're written out as part of the command.
+//
+func exportRequest(name string, req *http.Request, redact bool) (string, error) {
+	e := exporterNamed(name)
+	if e == nil {
+		return "", fmt.Errorf("Can't export to '%s', try one of %v", name, exporterNames())
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("Couldn't read the body: %v", err)
+		}
+	}
+
+	if bytes.IndexByte(body, 0) >= 0 || !utf8.Valid(body) {
+		return "", fmt.Errorf("The body isn't text, so can't be exported")
+	}
+
+	if redact {
+		req.Header = cloneHeader(req.Header)
+		for k := range req.Header {
+			for _, h := range redactedHeaders {
+				if strings.EqualFold(k, h) {
+					req.Header[k] = []string{redacted}
+				}
+			}
+		}
+	}
+
+	return e.render(req, body), nil
+}
+
+func cloneHeader(h http.Header) http.Header {
+	clone := make(http.Header, len(h))
+	for k, v := range h {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+//
+// sortedHeaders flattens the headers into name/value pairs, sorted so exports are predictable.
+//
+func sortedHeaders(h http.Header) [][2]string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var headers [][2]string
+	for _, k := range keys {
+		for _, v := range h[k] {
+			headers = append(headers, [2]string{k, v})
+		}
+	}
+	return headers
+}
+
+//
+// shellQuote quotes s for a POSIX shell.
+//
+func shellQuote(s string) string {
+	if len(s) > 0 && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+//
+// shellCommand joins arguments into a command, continuing it over several lines when it is long.
+//
+func shellCommand(args [][]string) string {
+	lines := make([]string, len(args))
+	for i, arg := range args {
+		quoted := make([]string, len(arg))
+		for j, a := range arg {
+			quoted[j] = shellQuote(a)
+		}
+		lines[i] = strings.Join(quoted, " ")
+	}
+
+	if len(lines) <= 2 {
+		return strings.Join(lines, " ") + "\n"
+	}
+	return strings.Join(lines, " \\\n  ") + "\n"
+}
+
+func exportCurl(req *http.Request, body []byte) string {
+	args := [][]string{{"curl"}}
+	switch req.Method {
+	case "GET":
+	case "HEAD":
+		args[0] = append(args[0], "-I")
+	default:
+		args[0] = append(args[0], "-X", req.Method)
+	}
+	args[0] = append(args[0], req.URL.String())
+
+	for _, h := range sortedHeaders(req.Header) {
+		args = append(args, []string{"-H", h[0] + ": " + h[1]})
+	}
+
+	if len(body) > 0 {
+		args = append(args, []string{"--data-raw", string(body)})
+	}
+	return shellCommand(args)
+}
+
+func exportHTTPie(req *http.Request, body []byte) string {
+	args := [][]string{{"http", req.Method, req.URL.String()}}
+	for _, h := range sortedHeaders(req.Header) {
+		args = append(args, []string{h[0] + ":" + h[1]})
+	}
+
+	if len(body) > 0 {
+		args = append(args, []string{"--raw", string(body)})
+	}
+	return shellCommand(args)
+}
+
+func exportWget(req *http.Request, body []byte) string {
+	args := [][]string{{"wget", "-O", "-"}}
+	if req.Method != "GET" {
+		args[0] = append(args[0], "--method="+req.Method)
+	}
+
+	for _, h := range sortedHeaders(req.Header) {
+		args = append(args, []string{"--header=" + h[0] + ": " + h[1]})
+	}
+
+	if len(body) > 0 {
+		args = append(args, []string{"--body-data=" + string(body)})
+	}
+	args = append(args, []string{req.URL.String()})
+	return shellCommand(args)
+}
+
+//
+// goString is a Go literal for s, a raw string where possible as it's easier to read.
+//
+func goString(s string) string {
+	if !strings.ContainsAny(s, "`\r") {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+//
+// exportGo writes a complete program using net/http, which prints the response.
+//
+func exportGo(req *http.Request, body []byte) string {
+	var b strings.Builder
+	b.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"io/ioutil\"\n\t\"net/http\"\n")
+	if len(body) > 0 {
+		b.WriteString("\t\"strings\"\n")
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+
+	if len(body) > 0 {
+		fmt.Fprintf(&b, "\tbody := strings.NewReader(%s)\n", goString(string(body)))
+		fmt.Fprintf(&b, "\treq, err := http.NewRequest(%q, %q, body)\n", req.Method, req.URL.String())
+	} else {
+		fmt.Fprintf(&b, "\treq, err := http.NewRequest(%q, %q, nil)\n", req.Method, req.URL.String())
+	}
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+
+	for _, h := range sortedHeaders(req.Header) {
+		fmt.Fprintf(&b, "\treq.Header.Add(%q, %q)\n", h[0], h[1])
+	}
+
+	b.WriteString(`
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(resp.Status)
+	fmt.Println(string(data))
+}
+`)
+	return b.String()
+}
+
+type exportCommand struct{}
+
+func (c *exportCommand) description() string {
+	return "Shows the last (or a saved) request as a curl, HTTPie or wget command or a Go program, or a collection for Postman"
+}
+
+func (c *exportCommand) usage() string {
+	return fmt.Sprintf("<%s> [saved request] [%s] [> file] | %s [collection] [%s] [> file] | %s [config] [> file]",
+		strings.Join(exporterNames(), "|"), redactFlag, postmanFormat, redactFlag, postmanEnvironmentFormat)
+}
+
+func (c *exportCommand) exec(tokens []string, term console, config *configuration) {
+	tokens, output := splitOutput(tokens[1:])
+
+	var args []string
+	redact := false
+	for _, token := range tokens {
+		if token == redactFlag {
+			redact = true
+		} else {
+			args = append(args, token)
+		}
+	}
+
+	if len(args) == 0 || len(args) > 2 {
+		term.printf("Usage: export %s\n", c.usage())
+		failures++
+		return
+	}
+	format := strings.ToLower(args[0])
+
+	var exported string
+	var err error
+	switch format {
+	case postmanFormat:
+		name := activeCollection(config)
+		if len(args) == 2 {
+			name = args[1]
+		}
+		exported, err = exportPostman(config, name, redact)
+	case postmanEnvironmentFormat:
+		name := config.name
+		if len(args) == 2 {
+			name = args[1]
+		}
+		exported, err = exportPostmanEnvironment(config, name)
+	default:
+		exported, err = exportLastRequest(config, format, args[1:], redact)
+	}
+	if err != nil {
+		term.printf("Couldn't export: %v\n", err)
+		failures++
+		return
+	}
+
+	if len(output) == 0 {
+		term.writeString(exported)
+		return
+	}
+
+	err = ioutil.WriteFile(output, []byte(exported), 0644)
+	if err != nil {
+		term.printf("Couldn't save the export: %v\n", err)
+		failures++
+		return
+	}
+	term.printf("Saved the %s export to %s\n", format, output)
+}
+
+//
+// exportLastRequest exports the last request, or the saved request named in args.
+//
+func exportLastRequest(config *configuration, format string, args []string, redact bool) (string, error) {
+	var req *http.Request
+	var err error
+	if len(args) > 0 {
+		req, err = buildSavedRequest(config, args[0])
+	} else if lastRequest == nil {
+		err = fmt.Errorf("No request has been sent yet")
+	} else {
+		req, err = lastRequest.build()
+	}
+	if err != nil {
+		return "", err
+	}
+	return exportRequest(format, req, redact)
+}
+
+func (c *exportCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return append(exporterNames(), postmanFormat, postmanEnvironmentFormat)
+	}
+	if len(tokens) == 3 {
+		switch tokens[1] {
+		case postmanFormat:
+			names, _ := listCollections()
+			return append(names, redactFlag)
+		case postmanEnvironmentFormat:
+			names, _ := listConfigs(configRoot)
+			return names
+		}
+		return append(savedRequestNames(config), redactFlag)
+	}
+	return nil
+}
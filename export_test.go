@@ -0,0 +1,135 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func exportTestRequest() *http.Request {
+	req, _ := http.NewRequest("POST", "https://example.com/items?page=2", strings.NewReader(`{"note":"it's"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestExportCurl(t *testing.T) {
+	exported, err := exportRequest("curl", exportTestRequest(), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	//
+	// Importing the export again should give back the same request
+	//
+	words, err := splitShellWords(exported)
+	if err != nil {
+		t.Fatalf("Couldn't split %v: %v", exported, err)
+	}
+	imported, err := parseCurl(words)
+	if err != nil {
+		t.Fatalf("Couldn't import %v: %v", exported, err)
+	}
+
+	spec := imported.spec
+	if spec.method != "POST" || spec.url != "https://example.com/items?page=2" || spec.body != `{"note":"it's"}` {
+		t.Fatalf("Expected the same request back, found %+v from %v", spec, exported)
+	}
+	if !hasHeaderItem(spec.items, "Authorization") || !hasHeaderItem(spec.items, "Content-Type") {
+		t.Fatalf("Expected the headers back, found %+v", spec.items)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	exported, _ := exportRequest("httpie", exportTestRequest(), true)
+	if !strings.HasPrefix(exported, "http POST 'https://example.com/items?page=2'") ||
+		!strings.Contains(exported, "Authorization:REDACTED") || strings.Contains(exported, "secret") {
+		t.Fatalf("Unexpected HTTPie export %v", exported)
+	}
+
+	exported, _ = exportRequest("wget", exportTestRequest(), false)
+	if !strings.Contains(exported, "--method=POST") || !strings.Contains(exported, `'--body-data={"note":"it'\''s"}'`) {
+		t.Fatalf("Unexpected wget export %v", exported)
+	}
+
+	exported, _ = exportRequest("go", exportTestRequest(), false)
+	formatted, err := format.Source([]byte(exported))
+	if err != nil {
+		t.Fatalf("Expected valid Go, found %v: %v", exported, err)
+	}
+	if !bytes.Equal(formatted, []byte(exported)) || !strings.Contains(exported, "strings.NewReader(`{\"note\":\"it's\"}`)") {
+		t.Fatalf("Unexpected Go export %v", exported)
+	}
+
+	get, _ := http.NewRequest("GET", "https://example.com/", nil)
+	if exported, _ = exportRequest("go", get, false); strings.Contains(exported, "strings") {
+		t.Fatalf("Expected no body for a GET, found %v", exported)
+	}
+
+	//
+	// curl would read a body starting with @ from a file, unless it's given with --data-raw
+	//
+	at, _ := http.NewRequest("POST", "https://example.com/", strings.NewReader("@/etc/passwd"))
+	if exported, _ = exportRequest("curl", at, false); !strings.Contains(exported, "--data-raw @/etc/passwd") {
+		t.Fatalf("Expected the body as --data-raw, found %v", exported)
+	}
+
+	binary, _ := http.NewRequest("POST", "https://example.com/", bytes.NewReader([]byte{0, 1, 2}))
+	if _, err := exportRequest("curl", binary, false); err == nil {
+		t.Fatalf("Expected a non-nil error value for a binary body!")
+	}
+	if _, err := exportRequest("postman", get, false); err == nil {
+		t.Fatalf("Expected a non-nil error value for an unknown format!")
+	}
+}
+
+func TestExportCommand(t *testing.T) {
+	saved := lastRequest
+	defer func() { lastRequest = saved }()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+
+	cmd := &exportCommand{}
+	lastRequest = nil
+	before := failures
+	cmd.exec([]string{"export", "curl"}, &captureConsole{}, defaultConfig())
+	if failures != before+1 {
+		t.Fatalf("Expected a failure without a request")
+	}
+
+	lastRequest = &recordedRequest{method: "DELETE", url: "https://example.com/items/1",
+		header: http.Header{"Authorization": {"Basic abc"}}}
+	output := filepath.Join(dir, "delete.sh")
+	capture := &captureConsole{}
+	cmd.exec([]string{"export", "curl", "--redact", ">", output}, capture, defaultConfig())
+
+	data, _ := ioutil.ReadFile(output)
+	if string(data) != "curl -X DELETE https://example.com/items/1 -H 'Authorization: REDACTED'\n" {
+		t.Fatalf("Unexpected export %q (%v)", data, capture.String())
+	}
+	if lastRequest.header.Get("Authorization") != "Basic abc" {
+		t.Fatalf("Expected the recorded request to be left alone")
+	}
+}
@@ -0,0 +1,721 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Request and response bodies larger than this aren't kept in a recording
+const harBodyLimit = 1 << 20
+
+const harTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Headers which are set by the client itself when a recorded request is sent again
+var harSkippedHeaders = []string{"Host", "Content-Length", "Connection", "Transfer-Encoding", "Accept-Encoding"}
+
+//
+// The structure of a HAR 1.2 file, see http://www.softwareishard.com/blog/har-12-spec/
+//
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []harNameValue `json:"params,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+//
+// harTimings are in milliseconds, -1 marking phases which didn't happen.  Unlike acromantula's own
+// timing, HAR counts the TLS handshake as part of connecting.
+//
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+//
+// harRecorder is the HAR file requests are being recorded to.
+//
+type harRecorder struct {
+	path   string
+	redact bool
+	har    *harFile
+
+	// The number of entries recorded since the file was last written, see flush
+	pending int
+}
+
+// The recording in progress, nil when requests aren't being recorded
+var recorder *harRecorder
+
+func loadHAR(path string) (*harFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	har := &harFile{}
+	err = json.Unmarshal(data, har)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a HAR file: %v", path, err)
+	}
+	return har, nil
+}
+
+//
+// startRecording records to path, adding to the entries already there if it's an existing HAR file.
+//
+func startRecording(path string, redact bool) (*harRecorder, error) {
+	har, err := loadHAR(path)
+	if os.IsNotExist(err) {
+		har, err = &harFile{Log: harLog{Version: "1.2", Entries: []*harEntry{}}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	har.Log.Creator = harCreator{Name: "Acromantula", Version: acroVersion}
+	r := &harRecorder{path: path, redact: redact, har: har}
+	return r, r.write()
+}
+
+func (r *harRecorder) write() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(r.har)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, buf.Bytes(), 0600)
+}
+
+//
+// flush writes the file if entries have been recorded since it was last written.  It's called once
+// a request is complete rather than for every entry, as a followed redirect gives several.
+//
+func (r *harRecorder) flush(term console) {
+	if r.pending == 0 {
+		return
+	}
+
+	err := r.write()
+	if err != nil {
+		term.printf("Couldn't record to %s: %v\n", r.path, err)
+		failures++
+		return
+	}
+	r.pending = 0
+}
+
+//
+// flushRecording writes out the recording in progress, if there is one.
+//
+func flushRecording(term console) {
+	if recorder != nil {
+		recorder.flush(term)
+	}
+}
+
+func harHeaders(header http.Header, redact bool) []harNameValue {
+	values := []harNameValue{}
+	for _, name := range sortHeaders(header) {
+		for _, value := range header[name] {
+			for _, h := range redactedHeaders {
+				if redact && strings.EqualFold(name, h) {
+					value = redacted
+				}
+			}
+			values = append(values, harNameValue{name, value})
+		}
+	}
+	return values
+}
+
+func harCookies(cookies []*http.Cookie) []harNameValue {
+	values := []harNameValue{}
+	for _, c := range cookies {
+		values = append(values, harNameValue{c.Name, c.Value})
+	}
+	return values
+}
+
+func harMillis(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return -1
+	}
+	return math.Round(float64(to.Sub(from))/float64(time.Microsecond)) / 1000
+}
+
+//
+// harTransport records each round trip while requests are being recorded, so every hop of a followed
+// redirect is an entry of its own, with its own timing.
+//
+type harTransport struct {
+	next http.RoundTripper
+}
+
+func (h *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if recorder == nil {
+		return h.next.RoundTrip(req)
+	}
+
+	timing := newRequestTiming()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timing.trace()))
+	exchange := recordRequest(req, timing)
+
+	response, err := h.next.RoundTrip(req)
+	if err != nil {
+		exchange.finish(nil, nil, err)
+		return nil, err
+	}
+
+	response.Body = &harBody{ReadCloser: response.Body, exchange: exchange, response: response}
+	return response, nil
+}
+
+//
+// harBody keeps (up to harBodyLimit of) a response body as it's read, completing the exchange once it
+// has been read or closed.
+//
+type harBody struct {
+	io.ReadCloser
+	exchange *harExchange
+	response *http.Response
+	kept     bytes.Buffer
+	size     int64
+	eof      bool
+	err      error
+	done     bool
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if b.kept.Len() <= harBodyLimit {
+		b.kept.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		b.eof = true
+		b.finish()
+	} else if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *harBody) finish() {
+	if !b.done {
+		b.done = true
+		b.exchange.finish(b.response, b, nil)
+	}
+}
+
+//
+// harExchange is a request being recorded, which is added to the recording once its response arrives.
+//
+type harExchange struct {
+	entry  *harEntry
+	timing *requestTiming
+}
+
+//
+// recordRequest starts an entry for req.  Bodies are read with GetBody, which leaves req's own body
+// to be sent.
+//
+func recordRequest(req *http.Request, timing *requestTiming) *harExchange {
+	request := harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(req.Header, recorder.redact),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+	}
+
+	for _, pair := range strings.Split(req.URL.RawQuery, "&") {
+		if len(pair) == 0 {
+			continue
+		}
+		name, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		request.QueryString = append(request.QueryString, harNameValue{name, value})
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		request.BodySize = req.ContentLength
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				data, err := ioutil.ReadAll(io.LimitReader(body, harBodyLimit+1))
+				body.Close()
+				if err == nil && len(data) <= harBodyLimit && utf8.Valid(data) {
+					request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(data)}
+					request.BodySize = int64(len(data))
+				}
+			}
+		}
+	}
+
+	entry := &harEntry{StartedDateTime: timing.start.Format(harTimeFormat), Request: request}
+	return &harExchange{entry: entry, timing: timing}
+}
+
+//
+// finish completes the entry with the response (or the error received instead) and adds it to the
+// recording.
+//
+func (x *harExchange) finish(response *http.Response, body *harBody, err error) {
+	if recorder == nil {
+		return
+	}
+
+	entry := x.entry
+	if response == nil {
+		entry.Response = harResponse{Cookies: []harNameValue{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+		if err != nil {
+			entry.Response.Comment = err.Error()
+		}
+	} else {
+		entry.Request.HTTPVersion = response.Proto
+		entry.Response = harResponse{
+			Status:      response.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(response.Status, strconv.Itoa(response.StatusCode))),
+			HTTPVersion: response.Proto,
+			Cookies:     harCookies(response.Cookies()),
+			Headers:     harHeaders(response.Header, false),
+			RedirectURL: response.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    body.size,
+			Content:     harContent{Size: body.size, MimeType: response.Header.Get("Content-Type")},
+		}
+
+		data := body.kept.Bytes()
+		switch {
+		case body.err != nil:
+			entry.Response.Content.Comment = fmt.Sprintf("Reading the body failed: %v", body.err)
+		case !body.eof && body.size != response.ContentLength:
+			entry.Response.Content.Comment = "The body wasn't read in full"
+		case body.size > harBodyLimit:
+			entry.Response.Content.Comment = "The body was too large to record"
+		case utf8.Valid(data):
+			entry.Response.Content.Text = string(data)
+		default:
+			entry.Response.Content.Text = base64.StdEncoding.EncodeToString(data)
+			entry.Response.Content.Encoding = "base64"
+		}
+	}
+
+	t := x.timing
+	if t.done.IsZero() {
+		t.done = time.Now()
+	}
+
+	// The connection is waited for until it's looked up, connected or reused, whichever comes first
+	waited := t.gotConn
+	if !t.dnsStart.IsZero() {
+		waited = t.dnsStart
+	} else if !t.connectStart.IsZero() {
+		waited = t.connectStart
+	}
+	connected := t.connectDone
+	if !t.tlsDone.IsZero() {
+		connected = t.tlsDone
+	}
+
+	entry.Time = harMillis(t.start, t.done)
+	entry.Timings = harTimings{
+		Blocked: harMillis(t.start, waited),
+		DNS:     harMillis(t.dnsStart, t.dnsDone),
+		Connect: harMillis(t.connectStart, connected),
+		Send:    math.Max(harMillis(t.gotConn, t.wroteRequest), 0),
+		Wait:    math.Max(harMillis(t.wroteRequest, t.firstByte), 0),
+		Receive: math.Max(harMillis(t.firstByte, t.done), 0),
+		SSL:     harMillis(t.tlsStart, t.tlsDone),
+	}
+	if t.conn.Conn != nil {
+		entry.ServerIPAddress, _, _ = net.SplitHostPort(t.conn.Conn.RemoteAddr().String())
+	}
+
+	recorder.har.Log.Entries = append(recorder.har.Log.Entries, entry)
+	recorder.pending++
+}
+
+//
+// build creates the entry's request, against root rather than the recorded host if root is given.
+// Headers the client sets itself, and HTTP/2's pseudo headers, are left out.
+//
+func (e *harEntry) build(root string) (*http.Request, error) {
+	target := e.Request.URL
+	if len(root) > 0 {
+		var err error
+		target, err = rebaseURL(target, root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var body io.Reader
+	if data := e.Request.PostData; data != nil {
+		text := data.Text
+		if len(text) == 0 && len(data.Params) > 0 {
+			if !strings.HasPrefix(data.MimeType, "application/x-www-form-urlencoded") {
+				return nil, fmt.Errorf("the %s body wasn't recorded", data.MimeType)
+			}
+			form := url.Values{}
+			for _, p := range data.Params {
+				form.Add(p.Name, p.Value)
+			}
+			text = form.Encode()
+		}
+		body = strings.NewReader(text)
+	} else if e.Request.BodySize > 0 {
+		return nil, fmt.Errorf("the body wasn't recorded")
+	}
+
+	req, err := http.NewRequest(e.Request.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range e.Request.Headers {
+		if strings.HasPrefix(h.Name, ":") || harSkippedHeader(h.Name) {
+			continue
+		}
+		req.Header.Add(h.Name, h.Value)
+	}
+	return req, nil
+}
+
+func harSkippedHeader(name string) bool {
+	for _, h := range harSkippedHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// rebaseURL moves raw to root's scheme and host, with root's path (if any) in front of its own.
+//
+func rebaseURL(raw, root string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := url.Parse(root)
+	if err != nil || len(r.Scheme) == 0 || len(r.Host) == 0 {
+		return "", fmt.Errorf("'%s' isn't an absolute URL", root)
+	}
+
+	u.Scheme, u.Host = r.Scheme, r.Host
+	if prefix := strings.TrimSuffix(r.Path, "/"); len(prefix) > 0 {
+		u.Path = prefix + u.Path
+		u.RawPath = ""
+	}
+	return u.String(), nil
+}
+
+//
+// selectHAREntries turns entry numbers, ranges such as 2-5, and 'all' into indexes of entries.
+//
+func selectHAREntries(entries []*harEntry, selectors []string) ([]int, error) {
+	var selected []int
+	for _, s := range selectors {
+		if s == "all" {
+			for i := range entries {
+				selected = append(selected, i)
+			}
+			continue
+		}
+
+		from, to := s, s
+		if i := strings.Index(s, "-"); i > 0 {
+			from, to = s[:i], s[i+1:]
+		}
+		first, err1 := strconv.Atoi(from)
+		last, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || first < 1 || last < first {
+			return nil, fmt.Errorf("'%s' isn't an entry number, a range such as 2-5 or all", s)
+		}
+		if last > len(entries) {
+			return nil, fmt.Errorf("%s is past the last entry, %d", s, len(entries))
+		}
+		for i := first; i <= last; i++ {
+			selected = append(selected, i-1)
+		}
+	}
+	return selected, nil
+}
+
+type recordCommand struct{}
+
+func (c *recordCommand) description() string {
+	return "Records every request and response to a HAR file, along with its timing"
+}
+
+func (c *recordCommand) usage() string {
+	return fmt.Sprintf("[<file.har> [%s]] | [stop]", redactFlag)
+}
+
+func (c *recordCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) == 1 {
+		if recorder == nil {
+			term.printf("Not recording, use '%s <file.har>' to start\n", tokens[0])
+		} else {
+			term.printf("Recording to %s, %d entries so far\n", recorder.path, len(recorder.har.Log.Entries))
+		}
+		return
+	}
+
+	if tokens[1] == "stop" {
+		if recorder == nil {
+			term.printf("Not recording\n")
+			failures++
+			return
+		}
+		recorder.flush(term)
+		term.printf("Recorded %d entries to %s\n", len(recorder.har.Log.Entries), recorder.path)
+		recorder = nil
+		return
+	}
+
+	redact := len(tokens) > 2 && tokens[2] == redactFlag
+	r, err := startRecording(tokens[1], redact)
+	if err != nil {
+		term.printf("Couldn't record to %s: %v\n", tokens[1], err)
+		failures++
+		return
+	}
+
+	recorder = r
+	if n := len(r.har.Log.Entries); n > 0 {
+		term.printf("Recording to %s, after its %d entries\n", r.path, n)
+	} else {
+		term.printf("Recording to %s\n", r.path)
+	}
+}
+
+func (c *recordCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return []string{"stop"}
+	}
+	if len(tokens) == 3 && tokens[1] != "stop" {
+		return []string{redactFlag}
+	}
+	return nil
+}
+
+//
+// harReplayCommand sends requests from a HAR file again, registered as 'replay' (unlike replayCommand,
+// which repeats the last request).
+//
+type harReplayCommand struct{}
+
+func (c *harReplayCommand) description() string {
+	return "Lists or sends requests from a HAR file (such as one exported from a browser) again"
+}
+
+func (c *harReplayCommand) usage() string {
+	return "<file.har> [<number>|<from-to>|all ...] [--root <url>]"
+}
+
+func (c *harReplayCommand) exec(tokens []string, term console, config *configuration) {
+	var args []string
+	root := ""
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] == "--root" && i+1 < len(tokens) {
+			root = tokens[i+1]
+			i++
+		} else {
+			args = append(args, tokens[i])
+		}
+	}
+
+	if len(args) == 0 {
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	har, err := loadHAR(args[0])
+	if err != nil {
+		term.printf("Couldn't read %s: %v\n", args[0], err)
+		failures++
+		return
+	}
+	entries := har.Log.Entries
+
+	if len(args) == 1 {
+		for i, e := range entries {
+			term.foreground(cyan)
+			term.printf(" %3d  ", i+1)
+			term.reset()
+			term.printf("%s %s", e.Request.Method, e.Request.URL)
+			term.dim()
+			term.printf("  %d\n", e.Response.Status)
+			term.reset()
+		}
+		return
+	}
+
+	selected, err := selectHAREntries(entries, args[1:])
+	if err == nil && len(root) > 0 {
+		root, err = interpolate(root)
+	}
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	//
+	// Every request is built before anything is sent, so a problem doesn't leave the replay half done
+	//
+	requests := make([]*http.Request, len(selected))
+	for n, i := range selected {
+		requests[n], err = entries[i].build(root)
+		if err != nil {
+			term.printf("Couldn't replay entry %d: %v\n", i+1, err)
+			failures++
+			return
+		}
+	}
+
+	for n, req := range requests {
+		before := failures
+		if len(requests) > 1 {
+			term.bright()
+			term.printf("\n# %d\n", selected[n]+1)
+			term.reset()
+		}
+
+		err = doRequest(term, req, responseOptions{})
+		if err != nil {
+			term.printf("Error performing %s: %v\n", req.Method, err)
+			failures++
+		}
+
+		if failures > before && len(requests) > 1 {
+			term.printf("Stopping, entry %d failed\n", selected[n]+1)
+			return
+		}
+	}
+}
+
+func (c *harReplayCommand) complete(tokens []string) []string {
+	if len(tokens) > 2 {
+		return []string{"all", "--root"}
+	}
+	return nil
+}
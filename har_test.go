@@ -0,0 +1,281 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRecordHAR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logo.png" {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig, savedRecorder := config, recorder
+	defer func() { config, recorder = savedConfig, savedRecorder }()
+	config = defaultConfig()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.har")
+
+	cmd := &recordCommand{}
+	term := &captureConsole{}
+	cmd.exec([]string{"record", path, redactFlag}, term, config)
+	if recorder == nil {
+		t.Fatalf("Expected to be recording: %v", term.String())
+	}
+
+	req, _ := http.NewRequest("POST", server.URL+"/items?page=2&tag=a%26b", strings.NewReader(`{"name":"acro"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	doRequest(term, req, responseOptions{})
+
+	req, _ = http.NewRequest("GET", server.URL+"/logo.png", nil)
+	doRequest(term, req, responseOptions{})
+
+	cmd.exec([]string{"record", "stop"}, term, config)
+	req, _ = http.NewRequest("GET", server.URL+"/ignored", nil)
+	doRequest(term, req, responseOptions{})
+
+	har, err := loadHAR(path)
+	if err != nil || len(har.Log.Entries) != 2 {
+		t.Fatalf("Expected 2 entries to be recorded, found %+v (%v)", har, err)
+	}
+	if har.Log.Version != "1.2" || har.Log.Creator.Name != "Acromantula" {
+		t.Fatalf("Unexpected log %+v", har.Log)
+	}
+
+	post := har.Log.Entries[0]
+	if post.Request.PostData == nil || post.Request.PostData.Text != `{"name":"acro"}` || post.Request.BodySize != 15 {
+		t.Fatalf("Unexpected request body %+v", post.Request)
+	}
+	if !reflect.DeepEqual(post.Request.QueryString, []harNameValue{{"page", "2"}, {"tag", "a&b"}}) {
+		t.Fatalf("Unexpected query string %v", post.Request.QueryString)
+	}
+	for _, h := range post.Request.Headers {
+		if h.Name == "Authorization" && h.Value != redacted {
+			t.Fatalf("Expected the Authorization header to be redacted, found %v", h.Value)
+		}
+	}
+	if post.Response.Status != 200 || post.Response.StatusText != "OK" || post.Response.Content.Text != `{"ok":true}` {
+		t.Fatalf("Unexpected response %+v", post.Response)
+	}
+	if post.Time <= 0 || post.Timings.Wait < 0 || post.Timings.Connect < 0 || post.Timings.SSL != -1 || post.ServerIPAddress != "127.0.0.1" {
+		t.Fatalf("Unexpected timing %v %+v from %v", post.Time, post.Timings, post.ServerIPAddress)
+	}
+
+	png := har.Log.Entries[1].Response.Content
+	if png.Encoding != "base64" || png.Text != "iVBOR/8=" || png.Size != 5 {
+		t.Fatalf("Expected a base64 body, found %+v", png)
+	}
+
+	//
+	// Recording to the same file again carries on after the entries already there
+	//
+	cmd.exec([]string{"record", path}, term, config)
+	doRequest(term, req, responseOptions{})
+	recorder = nil
+	if har, _ = loadHAR(path); len(har.Log.Entries) != 3 {
+		t.Fatalf("Expected a third entry, found %d", len(har.Log.Entries))
+	}
+
+	ioutil.WriteFile(path, []byte("not a HAR file"), 0600)
+	before := failures
+	cmd.exec([]string{"record", path}, term, config)
+	if failures != before+1 || recorder != nil {
+		t.Fatalf("Expected a failure recording over something that isn't a HAR file")
+	}
+}
+
+func TestRecordRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := r.URL.Query().Get("n"); n != "0" {
+			next, _ := strconv.Atoi(n)
+			http.Redirect(w, r, fmt.Sprintf("/redir?n=%d", next-1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("arrived"))
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig, savedRecorder, savedTerm := config, recorder, term
+	defer func() { config, recorder, term = savedConfig, savedRecorder, savedTerm }()
+	config = defaultConfig()
+	term = &captureConsole{}
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "redirects.har")
+
+	cmd := &recordCommand{}
+	cmd.exec([]string{"record", path}, term, config)
+	req, _ := http.NewRequest("GET", server.URL+"/redir?n=2", nil)
+	doRequest(term, req, responseOptions{})
+	recorder = nil
+
+	//
+	// Each hop is an entry of its own
+	//
+	har, _ := loadHAR(path)
+	if len(har.Log.Entries) != 3 {
+		t.Fatalf("Expected an entry for each hop, found %d", len(har.Log.Entries))
+	}
+	for i, expected := range []struct {
+		url, redirect string
+		status        int
+	}{{"/redir?n=2", "/redir?n=1", 302}, {"/redir?n=1", "/redir?n=0", 302}, {"/redir?n=0", "", 200}} {
+		entry := har.Log.Entries[i]
+		if entry.Request.URL != server.URL+expected.url || entry.Response.Status != expected.status || entry.Response.RedirectURL != expected.redirect {
+			t.Fatalf("Unexpected entry %d, %v %v %v", i+1, entry.Request.URL, entry.Response.Status, entry.Response.RedirectURL)
+		}
+		if entry.Time <= 0 || entry.Timings.Wait < 0 {
+			t.Fatalf("Unexpected timing for entry %d, %v %+v", i+1, entry.Time, entry.Timings)
+		}
+	}
+
+	if har.Log.Entries[0].Timings.Connect < 0 || har.Log.Entries[2].Timings.Connect != -1 {
+		t.Fatalf("Expected only the first hop to connect, found %+v and %+v", har.Log.Entries[0].Timings, har.Log.Entries[2].Timings)
+	}
+	if har.Log.Entries[2].Response.Content.Text != "arrived" {
+		t.Fatalf("Expected the final body, found %+v", har.Log.Entries[2].Response.Content)
+	}
+}
+
+func TestReplayHAR(t *testing.T) {
+	var received []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	saved := config
+	defer func() { config = saved }()
+	config = defaultConfig()
+	config.settings.Settings["staging"] = server.URL + "/v2/"
+
+	pwd, _ := os.Getwd()
+	path := filepath.Join(pwd, "tests/har/browser.har")
+	cmd := &harReplayCommand{}
+	term := &captureConsole{}
+
+	cmd.exec([]string{"replay", path}, term, config)
+	if !strings.Contains(term.String(), "2  POST https://shop.example.com/api/login  302\n") {
+		t.Fatalf("Expected the entries to be listed, found %v", term.String())
+	}
+
+	before := failures
+	cmd.exec([]string{"replay", path, "all"}, term, config)
+	if failures != before+1 || len(received) != 0 || !strings.Contains(term.String(), "Couldn't replay entry 3") {
+		t.Fatalf("Expected nothing to be sent when an entry's body is missing")
+	}
+
+	cmd.exec([]string{"replay", path, "1-2", "--root", "{{staging}}"}, term, config)
+	if failures != before+1 || len(received) != 2 {
+		t.Fatalf("Unexpected failure: %v", term.String())
+	}
+
+	get := received[0]
+	if get.URL.String() != "/v2/api/items?page=2" || get.Header.Get("X-Request-Id") != "abc" || get.Header.Get("Accept-Encoding") != "gzip" {
+		t.Fatalf("Unexpected request %v %v", get.URL, get.Header)
+	}
+	if received[1].Method != "POST" || bodies[1] != "password=a%26b&user=bob" {
+		t.Fatalf("Unexpected login %v %v", received[1].Method, bodies[1])
+	}
+
+	for _, selection := range []string{"0", "4", "3-1", "first"} {
+		cmd.exec([]string{"replay", path, selection}, term, config)
+	}
+	if failures != before+5 || len(received) != 2 {
+		t.Fatalf("Expected each bad selection to fail")
+	}
+}
+
+func TestRecordFlush(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig, savedRecorder, savedTerm := config, recorder, term
+	defer func() { config, recorder, term = savedConfig, savedRecorder, savedTerm }()
+	config = defaultConfig()
+	configureClient(config)
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.har")
+
+	capture := &captureConsole{}
+	term = capture
+	(&recordCommand{}).exec([]string{"record", path}, capture, config)
+
+	//
+	// Entries are kept in memory until the request is complete, then written once
+	//
+	response, err := client.Get(server.URL + "/old")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	response.Body.Close()
+	if har, _ := loadHAR(path); len(har.Log.Entries) != 0 || recorder.pending != 2 {
+		t.Fatalf("Expected the entries to be pending, found %d written and %d pending", len(har.Log.Entries), recorder.pending)
+	}
+	flushRecording(capture)
+	if har, _ := loadHAR(path); len(har.Log.Entries) != 2 || recorder.pending != 0 {
+		t.Fatalf("Expected both entries to be written, found %d", len(har.Log.Entries))
+	}
+
+	//
+	// A failed write is reported to the request's console
+	//
+	os.Remove(path)
+	os.Mkdir(path, 0700)
+	before := failures
+	capture.Reset()
+	term = &captureConsole{}
+	req, _ := http.NewRequest("GET", server.URL+"/new", nil)
+	doRequest(capture, req, responseOptions{})
+	if failures == before || !strings.Contains(capture.String(), "Couldn't record to "+path) {
+		t.Fatalf("Expected the write to fail, found %v", capture.String())
+	}
+}
@@ -18,7 +18,7 @@ package main
 
 type helpCommand struct{}
 
-func (c *helpCommand) exec(tokens []string, term *Term, config *configuration) {
+func (c *helpCommand) exec(tokens []string, term console, config *configuration) {
 	if len(tokens) == 1 {
 		term.printf("For help with a command, try 'help <cmd>', where <cmd> is one of:\n")
 
@@ -29,12 +29,14 @@ func (c *helpCommand) exec(tokens []string, term *Term, config *configuration) {
 		cmd := commands[tokens[1]]
 		if cmd == nil {
 			term.printf("Unknown command: %s\n", tokens[1])
+			failures++
 		} else {
 			term.printf("%s: %s\n", tokens[1], cmd.description())
 			term.printf("Usage: %s %s\n", tokens[1], cmd.usage())
 		}
 	} else {
-		term.printf("%s\n", c.usage())
+		term.printf("Usage: %s\n", c.usage())
+		failures++
 	}
 }
 
@@ -45,3 +47,10 @@ func (c *helpCommand) description() string {
 func (c *helpCommand) usage() string {
 	return "help <command>"
 }
+
+func (c *helpCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return sortCommands(commands)
+	}
+	return nil
+}
@@ -18,19 +18,96 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
-	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 )
 
-var transport = &http.Transport{DisableKeepAlives: false}
-var client = &http.Client{Timeout: time.Second * 10, Transport: transport}
+//
+// recordedResponse retains the parts of a response that are needed after its body
+// has been consumed and printed.
+//
+type recordedResponse struct {
+	status     string
+	statusCode int
+	header     http.Header
+	body       []byte
+	timing     *requestTiming
+
+	// The request this is the response to
+	request *recordedRequest
+
+	// Set when the body was streamed to this file rather than kept
+	savedTo string
+}
+
+// The most recent response received, nil until a request completes.
+var lastResponse *recordedResponse
+
+//
+// recordedRequest retains everything needed to send a request again.
+//
+type recordedRequest struct {
+	method  string
+	url     string
+	header  http.Header
+	options responseOptions
+
+	// Creates a fresh copy of the body, nil if there's no body or it can't be read again
+	getBody       func() (io.ReadCloser, error)
+	contentLength int64
+	chunked       bool
+	streamed      bool // the body was only available once, such as from stdin
+}
+
+//
+// responseOptions controls what happens to a response's body, by default it is rendered to the console.
+//
+type responseOptions struct {
+	query    string // show the results of this query against the body instead
+	output   string // stream the body to this file instead
+	download bool   // output may be adjusted or empty, and partial content is appended, see saveResponse
+}
+
+// The most recent request sent, whether or not it succeeded.
+var lastRequest *recordedRequest
+
+//
+// build creates a fresh request identical to the one recorded.
+//
+func (r *recordedRequest) build() (*http.Request, error) {
+	if r.streamed {
+		return nil, fmt.Errorf("the body was read from stdin, so can't be sent again")
+	}
+
+	req, err := http.NewRequest(r.method, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.getBody != nil {
+		req.Body, err = r.getBody()
+		if err != nil {
+			return nil, err
+		}
+		req.GetBody = r.getBody
+		req.ContentLength = r.contentLength
+		if r.chunked {
+			req.TransferEncoding = []string{"chunked"}
+		}
+	}
+
+	for k, v := range r.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return req, nil
+}
 
 type httpCommand struct {
 	method string
@@ -41,62 +118,55 @@ func (c *httpCommand) description() string {
 }
 
 func (c *httpCommand) usage() string {
-	return fmt.Sprintf("[url]")
+	return fmt.Sprintf("[url] [Header:value] [param==value] [| <query>] [> file]")
 }
 
-func (c *httpCommand) exec(tokens []string, term *Term, config *configuration) {
+func (c *httpCommand) exec(tokens []string, term console, config *configuration) {
 
-	//
-	// Enforcing the preconditions:  Either there must be no parameters after the GET/HEAD/delete
-	// command, or the first parameter must be a relative URL.
-	//
-	if len(tokens) > 2 || (len(tokens) == 2 && strings.HasPrefix(tokens[1], "@")) {
-		term.printf("Usage: %s [URL path]\n", c.method)
+	spec, err := parseRequestTokens(c.method, tokens[1:])
+	if err != nil {
+		term.printf("%v\n", err)
+		term.printf("Usage: %s %s\n", c.method, c.usage())
+		failures++
 		return
 	}
 
-	var urlToken string
-	if len(tokens) == 2 {
-		urlToken = tokens[1]
-	}
-
-	url, abs, err := buildURL(config.settings.Settings["root"], urlToken)
-	if err != nil {
-		term.printf("Couldn't build URL: %v\n", err)
+	//
+	// Enforcing the preconditions:  GET/HEAD/DELETE don't carry a body, so neither
+	// a data file nor data fields are allowed.
+	//
+	if spec.hasBody() {
+		term.printf("%s doesn't accept a request body\n", c.method)
+		term.printf("Usage: %s %s\n", c.method, c.usage())
+		failures++
 		return
 	}
+	rememberSpec(spec)
 
-	request, err := http.NewRequest(c.method, url.String(), nil)
+	request, err := spec.build(config, false)
 	if err != nil {
-		term.printf("Couldn't build request: %v\n", err)
+		term.printf("%v\n", err)
+		failures++
 		return
 	}
 
-	//
-	// If the user-supplied URL is absolute, don't attach the config's parameters/headers, as it may contain
-	// sensitive data.
-	//
-	if !abs {
-		//
-		// User-specified params.
-		//
-		params := request.URL.Query()
-		for k, v := range config.settings.Params {
-			params.Add(k, v)
-		}
-		request.URL.RawQuery = params.Encode()
-
-		for k, v := range config.settings.Headers {
-			request.Header[k] = []string{v}
-		}
-	}
-
-	err = doRequest(term, request)
+	err = doRequest(term, request, spec.options())
 	if err != nil {
 		term.printf("Error performing %s: %v\n", c.method, err)
+		failures++
+	}
+}
+
+func (c *httpCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return historyURLs(commandHistory)
 	}
+	return nil
 }
 
+// A host and port with no scheme, as in localhost:8080/x
+var hostPort = regexp.MustCompile(`^[\w.-]+:\d+(/|\?|$)`)
+
 //
 // Build out the URL to be used as part of the request.  This is determined based on the
 // 1) The root URL specified in the settings
@@ -111,6 +181,13 @@ func buildURL(root, token string) (*url.URL, bool, error) {
 		return nil, false, fmt.Errorf("Root and passed URL cannot both be empty")
 	}
 
+	//
+	// A host and port without a scheme (localhost:8080/x) would otherwise parse as the scheme 'localhost'
+	//
+	if hostPort.MatchString(token) {
+		token = "http://" + token
+	}
+
 	rootURL, _ := url.Parse(root)
 	tokenURL, _ := url.Parse(token)
 
@@ -133,112 +210,141 @@ type httpBodyCommand struct {
 }
 
 func (c *httpBodyCommand) usage() string {
-	return fmt.Sprintf("[<url> [@/path/to/file]]")
+	return fmt.Sprintf("[<url> [@/path/to/file]] [Header:value] [param==value] [field=value] [field:=json] [field@file[;type=mime]] [--multipart] ['<body>' | <<END | --edit] [| <query>] [> file]")
 }
 
 func (c *httpBodyCommand) description() string {
 	return fmt.Sprintf("Executes an HTTP %s request", c.method)
 }
 
-func (c *httpBodyCommand) exec(tokens []string, term *Term, config *configuration) {
+func (c *httpBodyCommand) exec(tokens []string, term console, config *configuration) {
 
-	//
-	// Enforcing the preconditions:  Either there must be no parameters after the GET/HEAD/delete
-	// command, or the first parameter must be a relative URL.
-	//
-	if len(tokens) > 3 || (len(tokens) == 2 && strings.HasPrefix(tokens[1], "@")) {
-		term.printf("Usage: %s [<URL path> [@/path/to/data]]\n", c.method)
+	spec, err := parseRequestTokens(c.method, tokens[1:])
+	if err != nil {
+		term.printf("%v\n", err)
+		term.printf("Usage: %s %s\n", c.method, c.usage())
+		failures++
 		return
 	}
 
-	var urlToken string
-	if len(tokens) > 1 {
-		urlToken = tokens[1]
-	}
-
-	postURL, abs, err := buildURL(config.settings.Settings["root"], urlToken)
+	err = spec.resolveBody(term)
 	if err != nil {
-		term.printf("Couldn't build URL: %v\n", err)
+		term.printf("Couldn't read the body, %v\n", err)
+		failures++
 		return
 	}
-
-	// Optional request body, may be either parameter or data based.
-	var body []byte
-	contentType := ""
+	rememberSpec(spec)
 
 	//
-	// If the user-supplied URL is absolute, don't attach the config's parameters/headers, as it may contain
-	// sensitive data.
+	// The config's params are sent as the body, this is overridden by any explicitly
+	// set data (see @ token and data fields).  Methods without a body of their own (such as
+	// 'request GET') send them in the query instead.
 	//
-	if !abs {
-		//
-		// User-specified params, this is overridden by any explicitly set POST
-		// data (see @ token)
-		//
-		params := url.Values{}
-		for k, v := range config.settings.Params {
-			params.Add(k, v)
-		}
-		if len(params) > 0 {
-			contentType = "application/x-www-form-urlencoded"
-			body = []byte(params.Encode())
-		}
-	}
-
-	//
-	// If any of the tokens starts with @, this is the file path to a data file that should be posted.
-	//
-	for _, token := range tokens {
-		if strings.HasPrefix(token, "@") {
-			dataFile := strings.TrimPrefix(token, "@")
-			data, err := ioutil.ReadFile(dataFile)
-			if err != nil {
-				term.printf("Could perform %s, cannot read %v: %v\n", c.method, dataFile, err)
-				return
-			}
-			body = data
-			contentType = contentTypes[strings.TrimPrefix(filepath.Ext(dataFile), ".")]
-			break
-		}
-	}
-
-	request, err := http.NewRequest(c.method, postURL.String(), bytes.NewReader(body))
+	request, err := spec.build(config, formParamsFor(c.method))
 	if err != nil {
-		term.printf("Couldn't build request: %v\n", err)
+		term.printf("Couldn't perform %s, %v\n", c.method, err)
+		failures++
 		return
 	}
+	rememberBody(spec)
 
-	if !abs {
-		for k, v := range config.settings.Headers {
-			request.Header[k] = []string{v}
-		}
-	}
-
-	// If no custom Content-Type has been specified, use what we've discovered
-	if len(config.settings.Headers["Content-Type"]) == 0 {
-		request.Header["Content-Type"] = []string{contentType}
-	}
-
-	err = doRequest(term, request)
+	err = doRequest(term, request, spec.options())
 	if err != nil {
 		term.printf("Error performing %s: %v\n", c.method, err)
+		failures++
 	}
 }
 
+func (c *httpBodyCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return historyURLs(commandHistory)
+	}
+	return nil
+}
+
 //
 // doRequest takes the supplied Request object and attempts to
-// execute it, displaying the response contents and possibly
-// returning an error condition if one occured.
+// execute it, displaying the response contents (or the result of
+// query, if supplied) and possibly returning an error condition if
+// one occured.
 //
-func doRequest(term *Term, req *http.Request) error {
+func doRequest(term console, req *http.Request, options responseOptions) (err error) {
+	err = configureClient(config)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return err
+	}
+
+	//
+	// Anything recorded is written out once the response's body has been closed
+	//
+	defer flushRecording(term)
+
 	term.writeString("\n<<  ")
 	term.underscore()
 	term.printf("%v %v\n", req.Method, req.URL)
 	term.reset()
 	printHeaders(" > ", term, req.Header)
+	printJarCookies(" > ", term, req.URL)
+
+	if proxy := proxyFor(req); len(proxy) > 0 {
+		term.printf(" >  (via proxy %v)\n", proxy)
+	}
+
+	if isInsecure(config.settings.Settings) {
+		term.bright()
+		term.writeString(" !  WARNING: insecure is set, TLS certificates are NOT being verified\n")
+		term.reset()
+	}
+
+	//
+	// Keep hold of the request so it can be replayed, bodies are recreated using GetBody so large
+	// files aren't held in memory
+	//
+	lastRequest = &recordedRequest{
+		method:        req.Method,
+		url:           req.URL.String(),
+		header:        req.Header,
+		options:       options,
+		getBody:       req.GetBody,
+		contentLength: req.ContentLength,
+		chunked:       len(req.TransferEncoding) > 0,
+		streamed:      req.Body != nil && req.Body != http.NoBody && req.GetBody == nil,
+	}
 
-	response, err := client.Do(req)
-	transport.CloseIdleConnections()
+	//
+	// Responses streamed to a file, and bodies streamed from one, may take any time at all.  So the
+	// timeout only applies while waiting for the response's headers, restarting as the body is sent.
+	//
+	do := client
+	var idle *idleTimeout
+	toFile := len(options.output) > 0 || options.download
+	streamedBody := isStreamedBody(req.Body)
+	if toFile || streamedBody {
+		do, req, idle = streamingClient(req)
+		defer idle.release()
+		defer func() { err = idle.wrap(err) }()
+	}
+	if streamedBody {
+		req.Body = &idleReader{ReadCloser: req.Body, idle: idle}
+	}
+	upload := trackUpload(term, req)
+
+	//
+	// Trace the request so we can show whether the connection was reused, and where the time went
+	//
+	timing := newRequestTiming()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timing.trace()))
+
+	response, err := do.Do(req)
+	if idle != nil {
+		idle.done()
+	}
+	if upload != nil {
+		upload.finish()
+	}
 	if err != nil {
 		return err
 	}
@@ -249,11 +355,73 @@ func doRequest(term *Term, req *http.Request) error {
 	term.printf("HTTP %v\n", response.Status)
 	term.reset()
 	printHeaders(" < ", term, response.Header)
-	printResponse(term, response)
+	printConnection(" < ", term, timing.conn)
+	saveCookies(term, config)
+
+	//
+	// Successful responses may be streamed straight to a file rather than held in memory, in which
+	// case the body isn't retained.  Error responses are always shown.
+	//
+	if toFile && (response.StatusCode < 400 || isComplete(response, options)) {
+		savedTo, err := saveResponse(term, response, options)
+		timing.done = time.Now()
+
+		lastResponse = &recordedResponse{
+			status:     response.Status,
+			statusCode: response.StatusCode,
+			header:     response.Header,
+			timing:     timing,
+			request:    lastRequest,
+			savedTo:    savedTo,
+		}
+		printTimingSetting(term, timing)
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(response.Body)
+	if err != nil {
+		return err
+	}
+	timing.done = time.Now()
+
+	//
+	// Error responses count as a failure, so that scripts can stop on them
+	//
+	if response.StatusCode >= 400 {
+		failures++
+	}
+
+	lastResponse = &recordedResponse{
+		status:     response.Status,
+		statusCode: response.StatusCode,
+		header:     response.Header,
+		body:       buf.Bytes(),
+		timing:     timing,
+		request:    lastRequest,
+	}
+
+	if len(options.query) > 0 {
+		printQuery(term, lastResponse.body, options.query)
+	} else {
+		printResponse(term, lastResponse.header.Get("Content-Type"), lastResponse.body, boolSettingValue(config.settings.Settings, "raw-output", false))
+	}
+
+	printTimingSetting(term, timing)
 	return nil
 }
 
-func printHeaders(prompt string, term *Term, headers http.Header) {
+//
+// printTimingSetting shows the timing of a request if the timing setting is on.
+//
+func printTimingSetting(term console, timing *requestTiming) {
+	if boolSettingValue(config.settings.Settings, "timing", false) {
+		term.writeString("\n")
+		printTiming(" ~ ", term, timing)
+	}
+}
+
+func printHeaders(prompt string, term console, headers http.Header) {
 
 	if len(headers["User-Agent"]) == 0 {
 		headers["User-Agent"] = []string{fmt.Sprintf("Acromantula %s", acroVersion)}
@@ -268,6 +436,39 @@ func printHeaders(prompt string, term *Term, headers http.Header) {
 	}
 }
 
+func printConnection(prompt string, term console, conn httptrace.GotConnInfo) {
+	if conn.Conn == nil {
+		return
+	}
+
+	state := "new"
+	if conn.Reused {
+		state = "reused"
+	}
+	term.printf("%v (%v connection to %v)\n", prompt, state, conn.Conn.RemoteAddr())
+}
+
+//
+// printJarCookies shows the cookies the client will add from the jar, as they aren't part of the request's
+// headers until it is sent.
+//
+func printJarCookies(prompt string, term console, u *url.URL) {
+	if client.Jar == nil {
+		return
+	}
+
+	jarCookies := client.Jar.Cookies(u)
+	if len(jarCookies) == 0 {
+		return
+	}
+
+	values := make([]string, len(jarCookies))
+	for i, c := range jarCookies {
+		values[i] = c.String()
+	}
+	term.printf("%v Cookie : [%v]\n", prompt, strings.Join(values, "; "))
+}
+
 func sortHeaders(h http.Header) []string {
 	keys := make([]string, len(h))
 	i := 0
@@ -280,22 +481,53 @@ func sortHeaders(h http.Header) []string {
 	return keys
 }
 
-func printResponse(term *Term, response *http.Response) {
+func printResponse(term console, contentType string, body []byte, raw bool) {
 	term.writeString("\n<<  ")
 	term.underscore()
 	term.writeString("Content:\n")
 	term.reset()
-	if response.ContentLength != 0 {
-		formatted := new(bytes.Buffer)
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(response.Body)
-		bytes := buf.Bytes()
-		error := json.Indent(formatted, bytes, "", "  ")
-		if error != nil {
-			term.writeBytes(bytes)
-		} else {
-			term.writeBytes(formatted.Bytes())
-		}
+	if len(body) != 0 {
+		renderBody(term, contentType, body, raw)
 		term.writeString("\n")
 	}
 }
+
+//
+// requestCommand allows any method token to be used, such as PROPFIND or a custom verb.  The request
+// itself is handled just like a PUT/POST, so an optional body may be supplied with @, except that the
+// configuration's params go in the query for GET, HEAD, DELETE and OPTIONS.
+//
+type requestCommand struct{}
+
+func (c *requestCommand) usage() string {
+	return fmt.Sprintf("<METHOD> [<url> [@/path/to/file]] [items...] [| <query>] [> file]")
+}
+
+func (c *requestCommand) description() string {
+	return "Executes an HTTP request with an arbitrary method"
+}
+
+func (c *requestCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) < 2 || len(tokens[1]) == 0 {
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	//
+	// Strip the method token off, the remaining tokens look exactly like a PUT/POST
+	//
+	cmd := &httpBodyCommand{method: strings.ToUpper(tokens[1])}
+	cmd.exec(append([]string{tokens[0]}, tokens[2:]...), term, config)
+}
+
+func (c *requestCommand) complete(tokens []string) []string {
+	switch len(tokens) {
+	case 2:
+		return []string{"CONNECT", "COPY", "DELETE", "GET", "HEAD", "LOCK", "MKCOL", "MOVE", "OPTIONS", "PATCH",
+			"POST", "PROPFIND", "PROPPATCH", "PUT", "TRACE", "UNLOCK"}
+	case 3:
+		return historyURLs(commandHistory)
+	}
+	return nil
+}
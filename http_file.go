@@ -0,0 +1,558 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// References within .http files may include system variables with arguments ({{$randomInt 1 10}})
+// and request variables ({{login.response.body.$.token}}), so this is looser than variablePattern.
+//
+var httpFileVariablePattern = regexp.MustCompile(`{{\s*([^{}\s]+)((?:\s+[^{}\s]+)*)\s*}}`)
+
+var httpFileVariableDefinition = regexp.MustCompile(`^@([A-Za-z0-9_.\-]+)\s*=\s*(.*)$`)
+
+var httpFileNameComment = regexp.MustCompile(`^(?:#|//)\s*@name[\s=]+(\S+)`)
+
+// Request variables can refer to each other, but not forever
+const maxVariableDepth = 10
+
+//
+// httpFile is a VS Code REST Client or JetBrains HTTP client file, holding requests separated by
+// ### lines and the file's own @name = value variables.
+//
+type httpFile struct {
+	path      string
+	variables map[string]string
+	requests  []*httpFileRequest
+}
+
+type httpFileRequest struct {
+	name     string
+	method   string
+	url      string
+	headers  [][2]string
+	body     string
+	bodyFile string // from a '< path' body, relative to the file
+	process  bool   // '<@ path', variables in the body file are substituted
+}
+
+//
+// The .http file in use, it is read again each time it is used so edits are picked up.
+//
+var loadedHTTPFile string
+
+//
+// Responses to named requests in the .http file, for use by request variables.
+//
+var httpFileResponses = map[string]*recordedResponse{}
+
+func loadHTTPFile(path string) (*httpFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := parseHTTPFile(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	f.path = path
+	return f, nil
+}
+
+//
+// parseHTTPFile reads requests and variables from the contents of a .http file.
+//
+func parseHTTPFile(data string) (*httpFile, error) {
+	f := &httpFile{variables: map[string]string{}}
+	lines := strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n")
+
+	start, name := 0, ""
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && !strings.HasPrefix(lines[i], "###") {
+			continue
+		}
+
+		err := f.parseBlock(lines[start:i], start+1, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if i < len(lines) {
+			name = strings.TrimSpace(strings.TrimPrefix(lines[i], "###"))
+			start = i + 1
+		}
+	}
+	return f, nil
+}
+
+//
+// parseBlock reads the request between two ### separators.  Blocks holding only comments and
+// variables are fine, they just don't add a request.
+//
+func (f *httpFile) parseBlock(lines []string, firstLine int, name string) error {
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if m := httpFileNameComment.FindStringSubmatch(line); m != nil {
+			name = m[1]
+			continue
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if m := httpFileVariableDefinition.FindStringSubmatch(line); m != nil {
+			f.variables[m[1]] = strings.TrimSpace(m[2])
+			continue
+		}
+		break
+	}
+
+	if i == len(lines) {
+		return nil
+	}
+
+	r := &httpFileRequest{name: name, method: "GET"}
+	fields := strings.Fields(lines[i])
+	if len(fields) > 1 && isMethodToken(fields[0]) {
+		r.method = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) > 1 && strings.HasPrefix(fields[len(fields)-1], "HTTP/") {
+		fields = fields[:len(fields)-1]
+	}
+	r.url = strings.Join(fields, " ")
+
+	//
+	// The query may continue over several lines, each starting with ? or &
+	//
+	for i++; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "?") && !strings.HasPrefix(line, "&") {
+			break
+		}
+		r.url += line
+	}
+
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if len(line) == 0 {
+			i++
+			break
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return fmt.Errorf("line %d: '%s' isn't a header", firstLine+i, line)
+		}
+		r.headers = append(r.headers, [2]string{strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])})
+	}
+
+	r.body = strings.TrimSpace(strings.Join(stripResponseHandlers(lines[i:]), "\n"))
+	if !strings.Contains(r.body, "\n") {
+		if strings.HasPrefix(r.body, "<@") {
+			r.bodyFile, r.process, r.body = strings.TrimSpace(r.body[2:]), true, ""
+		} else if strings.HasPrefix(r.body, "< ") {
+			r.bodyFile, r.body = strings.TrimSpace(r.body[1:]), ""
+		}
+	}
+
+	f.requests = append(f.requests, r)
+	return nil
+}
+
+//
+// stripResponseHandlers removes JetBrains response handler scripts (> {% ... %}, or > script.js) and
+// response references (<> file), which only make sense within the IDE.
+//
+func stripResponseHandlers(lines []string) []string {
+	var kept []string
+	inScript := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inScript:
+			inScript = !strings.HasSuffix(trimmed, "%}")
+		case strings.HasPrefix(trimmed, "> {%"):
+			inScript = !strings.HasSuffix(trimmed, "%}")
+		case strings.HasPrefix(trimmed, "<> "), strings.HasPrefix(trimmed, "> ") && strings.HasSuffix(trimmed, ".js"):
+		default:
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+func isMethodToken(token string) bool {
+	for _, c := range token {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return len(token) > 0
+}
+
+//
+// title is how the request is shown in lists, its name if it has one.
+//
+func (r *httpFileRequest) title() string {
+	if len(r.name) > 0 {
+		return r.name
+	}
+	return fmt.Sprintf("%s %s", r.method, r.url)
+}
+
+//
+// find looks a request up by name or by its 1 based position within the file.
+//
+func (f *httpFile) find(ref string) (*httpFileRequest, error) {
+	for _, r := range f.requests {
+		if r.name == ref {
+			return r, nil
+		}
+	}
+
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 || n > len(f.requests) {
+		return nil, fmt.Errorf("There's no request called %s in %s", ref, f.path)
+	}
+	return f.requests[n-1], nil
+}
+
+//
+// resolve substitutes the file's variables, system variables and request variables in s.  Anything
+// else is left for interpolate, so session variables can be used as well.
+//
+func (f *httpFile) resolve(s string, depth int) (string, error) {
+	if depth > maxVariableDepth {
+		return "", fmt.Errorf("Variables refer to each other too deeply")
+	}
+
+	var err error
+	result := httpFileVariablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := httpFileVariablePattern.FindStringSubmatch(match)
+		name, args := m[1], strings.Fields(m[2])
+
+		var value string
+		var e error
+		defined, isFileVariable := f.variables[name]
+		switch {
+		case strings.HasPrefix(name, "$"):
+			value, e = systemVariable(name, args)
+		case isFileVariable:
+			value, e = f.resolve(defined, depth+1)
+		case strings.Contains(name, ".response."):
+			value, e = requestVariable(name)
+		default:
+			return match
+		}
+
+		if e != nil && err == nil {
+			err = e
+		}
+		return value
+	})
+	return result, err
+}
+
+//
+// systemVariable produces the value of one of the dynamic variables such as {{$guid}}.
+//
+func systemVariable(name string, args []string) (string, error) {
+	switch name {
+	case "$guid", "$uuid", "$random.uuid":
+		b := make([]byte, 16)
+		rand.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+	case "$timestamp":
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+	case "$isoTimestamp":
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case "$datetime":
+		if len(args) > 0 && args[0] == "rfc1123" {
+			return time.Now().UTC().Format(http.TimeFormat), nil
+		}
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case "$randomInt", "$random.integer":
+		min, max := int64(0), int64(1000)
+		if len(args) == 2 {
+			var err1, err2 error
+			min, err1 = strconv.ParseInt(args[0], 10, 64)
+			max, err2 = strconv.ParseInt(args[1], 10, 64)
+			if err1 != nil || err2 != nil || max <= min {
+				return "", fmt.Errorf("{{%s}} needs a minimum and a larger maximum", name)
+			}
+		}
+		n, _ := rand.Int(rand.Reader, big.NewInt(max-min))
+		return strconv.FormatInt(min+n.Int64(), 10), nil
+	case "$processEnv":
+		if len(args) != 1 {
+			return "", fmt.Errorf("{{$processEnv}} needs the name of an environment variable")
+		}
+		return os.Getenv(args[0]), nil
+	}
+	return "", fmt.Errorf("{{%s}} isn't supported", name)
+}
+
+//
+// requestVariable looks up part of an earlier response to a named request, such as
+// login.response.body.$.token or login.response.headers.Location.
+//
+func requestVariable(name string) (string, error) {
+	i := strings.Index(name, ".response.")
+	request, part := name[:i], name[i+len(".response."):]
+
+	response := httpFileResponses[request]
+	if response == nil {
+		return "", fmt.Errorf("%s needs a response to %s, run it first", name, request)
+	}
+
+	switch {
+	case strings.HasPrefix(part, "headers."):
+		return response.header.Get(strings.TrimPrefix(part, "headers.")), nil
+	case part == "body.*" || part == "body":
+		return string(response.body), nil
+	case strings.HasPrefix(part, "body."):
+		data, err := decodeJSON(response.body)
+		if err != nil {
+			return "", fmt.Errorf("The response to %s isn't valid JSON: %v", request, err)
+		}
+		value, err := queryValue(data, strings.TrimPrefix(part, "body."))
+		if err != nil {
+			return "", fmt.Errorf("Couldn't evaluate %s: %v", name, err)
+		}
+		return formatValue(value), nil
+	}
+	return "", fmt.Errorf("%s isn't supported, try %s.response.body.$.path or %s.response.headers.Name", name, request, request)
+}
+
+//
+// spec resolves the request's variables, giving a requestSpec for the usual request pipeline.
+//
+func (f *httpFile) spec(r *httpFileRequest) (*requestSpec, error) {
+	var err error
+	spec := &requestSpec{method: r.method}
+
+	spec.url, err = f.resolve(r.url, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range r.headers {
+		value, err := f.resolve(h[1], 0)
+		if err != nil {
+			return nil, err
+		}
+		spec.items = append(spec.items, requestItem{kind: headerItem, key: h[0], value: value})
+	}
+
+	body := r.body
+	if len(r.bodyFile) > 0 {
+		path := r.bodyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(f.path), path)
+		}
+
+		if !r.process {
+			spec.bodyFile = path
+			return spec, nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+
+	spec.body, err = f.resolve(body, 0)
+	return spec, err
+}
+
+//
+// runHTTPFileRequest sends a request from the file, keeping its response if it's named.
+//
+func runHTTPFileRequest(term console, config *configuration, f *httpFile, r *httpFileRequest) {
+	spec, err := f.spec(r)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	previous := lastResponse
+	sendSpec(term, config, spec)
+	if len(r.name) > 0 && lastResponse != previous {
+		httpFileResponses[r.name] = lastResponse
+	}
+}
+
+type httpFileCommand struct{}
+
+func (c *httpFileCommand) description() string {
+	return "Loads and runs requests from a VS Code REST Client or JetBrains .http file"
+}
+
+func (c *httpFileCommand) usage() string {
+	return "[load <file>] | [list] | [vars] | [run <name|number> ...]"
+}
+
+func (c *httpFileCommand) exec(tokens []string, term console, config *configuration) {
+	option := "list"
+	if len(tokens) > 1 {
+		option = tokens[1]
+	}
+
+	path := loadedHTTPFile
+	if option == "load" {
+		if len(tokens) < 3 {
+			term.printf("Please supply a file, such as '%s load api.http'\n", tokens[0])
+			failures++
+			return
+		}
+		path = tokens[2]
+	}
+
+	if len(path) == 0 {
+		term.printf("No .http file has been loaded, use '%s load <file>'\n", tokens[0])
+		failures++
+		return
+	}
+
+	f, err := loadHTTPFile(path)
+	if err != nil {
+		term.printf("Couldn't read the .http file: %v\n", err)
+		failures++
+		return
+	}
+
+	if option == "load" {
+		loadedHTTPFile = path
+		httpFileResponses = map[string]*recordedResponse{}
+	}
+
+	switch option {
+	case "load", "list":
+		if len(f.requests) == 0 {
+			term.printf("%s has no requests\n", f.path)
+			return
+		}
+		width := 0
+		for _, r := range f.requests {
+			if len(r.name) > width {
+				width = len(r.name)
+			}
+		}
+		for i, r := range f.requests {
+			term.foreground(cyan)
+			term.printf(" %3d  ", i+1)
+			term.reset()
+			if width > 0 {
+				term.printf("%-*s  ", width, r.name)
+			}
+			term.dim()
+			term.printf("%s %s\n", r.method, r.url)
+			term.reset()
+		}
+	case "vars":
+		names := make([]string, 0, len(f.variables))
+		for name := range f.variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			term.printf(" %v => %v\n", name, f.variables[name])
+		}
+	case "run":
+		if len(tokens) < 3 {
+			term.printf("Please supply a request name or number, such as '%s run 1'\n", tokens[0])
+			failures++
+			return
+		}
+
+		var selected []*httpFileRequest
+		for _, ref := range tokens[2:] {
+			r, err := f.find(ref)
+			if err != nil {
+				term.printf("%v\n", err)
+				failures++
+				return
+			}
+			selected = append(selected, r)
+		}
+
+		for _, r := range selected {
+			before := failures
+			if len(selected) > 1 {
+				term.bright()
+				term.printf("\n# %s\n", r.title())
+				term.reset()
+			}
+
+			runHTTPFileRequest(term, config, f, r)
+			if failures > before && len(selected) > 1 {
+				term.printf("Stopping, %s failed\n", r.title())
+				return
+			}
+		}
+	default:
+		term.printf("Unknown option '%s', try one of [load, list, vars, run]\n", option)
+		failures++
+	}
+}
+
+func (c *httpFileCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return []string{"load", "list", "vars", "run"}
+	}
+
+	if len(tokens) >= 3 && tokens[1] == "run" && len(loadedHTTPFile) > 0 {
+		f, err := loadHTTPFile(loadedHTTPFile)
+		if err != nil {
+			return nil
+		}
+		var names []string
+		for i, r := range f.requests {
+			if len(r.name) > 0 {
+				names = append(names, r.name)
+			} else {
+				names = append(names, strconv.Itoa(i+1))
+			}
+		}
+		return names
+	}
+	return nil
+}
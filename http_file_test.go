@@ -0,0 +1,155 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseHTTPFile(t *testing.T) {
+	pwd, _ := os.Getwd()
+	f, err := loadHTTPFile(filepath.Join(pwd, "tests/http/sample.http"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(f.requests) != 3 || len(f.variables) != 2 {
+		t.Fatalf("Expected 3 requests and 2 variables, found %d and %v", len(f.requests), f.variables)
+	}
+
+	login := f.requests[0]
+	if login.name != "login" || login.method != "POST" || login.url != "{{host}}/login" {
+		t.Fatalf("Unexpected request %+v", login)
+	}
+	if !strings.HasPrefix(login.body, "{\n") || !strings.HasSuffix(login.body, "\n}") {
+		t.Fatalf("Unexpected body %q", login.body)
+	}
+
+	items := f.requests[1]
+	expected := [][2]string{{"Authorization", "{{token}}"}, {"Accept", "application/json"}}
+	if items.name != "List items" || items.url != "{{host}}/items?page=2&size=10" || !reflect.DeepEqual(items.headers, expected) {
+		t.Fatalf("Unexpected request %+v", items)
+	}
+	if len(items.body) > 0 {
+		t.Fatalf("Expected the response handler to be dropped, found %q", items.body)
+	}
+
+	if put := f.requests[2]; put.name != "" || put.bodyFile != "./item.txt" {
+		t.Fatalf("Unexpected request %+v", put)
+	}
+
+	if r, err := f.find("3"); err != nil || r != f.requests[2] {
+		t.Fatalf("Expected the third request, found %v (%v)", r, err)
+	}
+	for _, ref := range []string{"0", "4", "missing"} {
+		if _, err := f.find(ref); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", ref)
+		}
+	}
+
+	if _, err := parseHTTPFile("GET /items\nnot a header\n"); err == nil {
+		t.Fatalf("Expected a non-nil error value for a bad header!")
+	}
+}
+
+func TestHTTPFileVariables(t *testing.T) {
+	f := &httpFile{variables: map[string]string{"a": "{{b}}", "b": "{{a}}", "c": "{{session}}"}}
+	if _, err := f.resolve("{{a}}", 0); err == nil {
+		t.Fatalf("Expected a non-nil error value for variables referring to each other!")
+	}
+
+	if value, err := f.resolve("{{c}}", 0); err != nil || value != "{{session}}" {
+		t.Fatalf("Expected session variables to be left for interpolate, found %v (%v)", value, err)
+	}
+
+	value, err := f.resolve("{{$guid}} {{$randomInt 5 6}} {{$timestamp}}", 0)
+	if err != nil || !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12} 5 \d+$`).MatchString(value) {
+		t.Fatalf("Unexpected system variables %v (%v)", value, err)
+	}
+
+	for _, s := range []string{"{{$unknown}}", "{{$randomInt 9 1}}", "{{never.response.body.$.id}}"} {
+		if _, err := f.resolve(s, 0); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", s)
+		}
+	}
+}
+
+func TestRunHTTPFile(t *testing.T) {
+	received := map[string]*http.Request{}
+	bodies := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received[r.Method] = r
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies[r.Method] = string(body)
+		if r.URL.Path == "/api/login" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"token":"abc"}`))
+		}
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig, savedFile := config, loadedHTTPFile
+	defer func() { config, loadedHTTPFile = savedConfig, savedFile }()
+	config = defaultConfig()
+
+	variables["baseUrl"] = server.URL
+	defer delete(variables, "baseUrl")
+
+	pwd, _ := os.Getwd()
+	cmd := &httpFileCommand{}
+	term := &captureConsole{}
+	before := failures
+
+	cmd.exec([]string{"http-file", "run", "1"}, term, config)
+	if failures != before+1 {
+		t.Fatalf("Expected a failure without a file")
+	}
+
+	cmd.exec([]string{"http-file", "load", filepath.Join(pwd, "tests/http/sample.http")}, term, config)
+	if !strings.Contains(term.String(), "List items  ") {
+		t.Fatalf("Expected the requests to be listed, found %v", term.String())
+	}
+
+	cmd.exec([]string{"http-file", "run", "List items"}, term, config)
+	if failures != before+2 || received["GET"] != nil {
+		t.Fatalf("Expected the token to be missing until login is run")
+	}
+
+	cmd.exec([]string{"http-file", "run", "login", "List items", "3"}, term, config)
+	if failures != before+2 {
+		t.Fatalf("Unexpected failure: %v", term.String())
+	}
+
+	if !strings.Contains(bodies["POST"], `"user": "bob"`) || strings.Contains(bodies["POST"], "$guid") {
+		t.Fatalf("Unexpected login body %v", bodies["POST"])
+	}
+	if get := received["GET"]; get.URL.RawQuery != "page=2&size=10" || get.Header.Get("Authorization") != "Bearer abc" {
+		t.Fatalf("Unexpected request %v %v", get.URL, get.Header)
+	}
+	if bodies["PUT"] != "from a file\n" || received["PUT"].Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("Unexpected PUT body %q", bodies["PUT"])
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Given anywhere in a request's tokens, opens an editor to compose the body
+const editFlag = "--edit"
+
+// Prefix of the token starting paste mode, such as <<EOF
+const pastePrefix = "<<"
+
+//
+// The most recent body sent to each URL (as it was typed), used to prefill the editor.
+//
+var recentBodies = map[string]string{}
+
+//
+// isInlineBody determines if a token is a body given on the command line, such as '{"a":1}'.
+// A leading {{ is a variable reference rather than JSON.
+//
+func isInlineBody(token string) bool {
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, "{{") {
+		return false
+	}
+	return strings.HasPrefix(token, "{") || strings.HasPrefix(token, "[")
+}
+
+//
+// inlineContentType is the Content-Type for a body typed, pasted or edited by hand.
+//
+func inlineContentType(body string) string {
+	if json.Valid([]byte(body)) {
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+//
+// rememberBody keeps the body of a request that's about to be sent, if it was composed on the command
+// line, so --edit can start from it next time.  It's kept as typed, before variables are substituted,
+// so their values don't end up in the editor's temporary file.
+//
+func rememberBody(spec *requestSpec) {
+	if spec.multipart {
+		return
+	}
+
+	if len(spec.body) > 0 {
+		recentBodies[spec.url] = spec.body
+		return
+	}
+
+	//
+	// Data fields are composed as they'll be sent, a raw JSON field holding a variable (n:={{n}})
+	// isn't JSON until it's substituted, so such a body isn't kept
+	//
+	data, err := spec.jsonBody()
+	if err == nil && data != nil {
+		recentBodies[spec.url] = string(data)
+	}
+}
+
+//
+// resolveBody reads the body for a paste or --edit request, it does nothing for other requests.
+//
+func (s *requestSpec) resolveBody(term console) error {
+	if len(s.sentinel) > 0 {
+		body, err := readPastedBody(term, s.sentinel)
+		if err != nil {
+			return err
+		}
+		s.body = body
+	}
+
+	if s.edit {
+		initial := s.body
+		if len(initial) == 0 {
+			initial = recentBodies[s.url]
+		}
+
+		body, err := editBody(term, initial)
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(body)) == 0 {
+			return fmt.Errorf("The body is empty, not sending")
+		}
+		s.body = body
+	}
+
+	return nil
+}
+
+//
+// readPastedBody reads lines until one consists of just the sentinel.
+//
+func readPastedBody(term console, sentinel string) (string, error) {
+	var lines []string
+	for {
+		line, err := term.readRaw("... ")
+		if err == io.EOF {
+			return "", fmt.Errorf("Reached the end of input before %s", sentinel)
+		} else if err != nil {
+			return "", err
+		}
+
+		if strings.TrimSpace(line) == sentinel {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+//
+// editorCommand is $VISUAL, $EDITOR or vi, in that order.
+//
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+//
+// editBody opens the editor on a temporary file holding initial, returning what was saved.  The
+// terminal is handed over to the editor while it runs.
+//
+func editBody(term console, initial string) (string, error) {
+	file, err := ioutil.TempFile("", "acro-body-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(initial)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if t, ok := term.(*Term); ok {
+		t.suspend()
+		defer t.resume()
+	}
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %v", editor[0], err)
+	}
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
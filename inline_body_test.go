@@ -0,0 +1,154 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInlineBody(t *testing.T) {
+	spec, err := parseRequestTokens("POST", []string{"/items", `{"a":1}`, "X-Test:one"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if spec.body != `{"a":1}` || !spec.hasBody() || len(spec.items) != 1 {
+		t.Fatalf("Expected an inline body and one header, found %+v", spec)
+	}
+
+	req, err := spec.build(defaultConfig(), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"a":1}` || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected the inline JSON body, found %s (%v)", body, req.Header.Get("Content-Type"))
+	}
+	if _, ok := recentBodies["/items"]; ok {
+		t.Fatalf("Expected the body to be remembered only once it's sent")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	saved := config
+	defer func() { config = saved }()
+	config = defaultConfig()
+	config.settings.Settings["root"] = server.URL
+	(&httpBodyCommand{method: "POST"}).exec([]string{"post", "/items", "name=acro"}, &captureConsole{}, config)
+	if recentBodies["/items"] != `{"name":"acro"}` {
+		t.Fatalf("Expected the body to be remembered, found %v", recentBodies["/items"])
+	}
+
+	//
+	// Bodies are remembered as typed, so a variable's value isn't written out when editing them
+	//
+	variables["secret"] = "hunter2"
+	defer delete(variables, "secret")
+	(&httpBodyCommand{method: "POST"}).exec([]string{"post", "/items", "password={{secret}}"}, &captureConsole{}, config)
+	(&httpBodyCommand{method: "POST"}).exec([]string{"post", "/login", `{"password":"{{secret}}"}`}, &captureConsole{}, config)
+	if recentBodies["/items"] != `{"password":"{{secret}}"}` || recentBodies["/login"] != `{"password":"{{secret}}"}` {
+		t.Fatalf("Expected the bodies before interpolation, found %v", recentBodies)
+	}
+
+	for _, tokens := range [][]string{{"/items", `{"a":1}`, `[2]`}, {"/items", "<<"}, {"/items", "[1]", "<<EOF"}} {
+		if _, err := parseRequestTokens("POST", tokens); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", tokens)
+		}
+	}
+
+	spec, _ = parseRequestTokens("POST", []string{"/items", `[1]`, "name=acro"})
+	if _, err := spec.build(defaultConfig(), true); err == nil {
+		t.Fatalf("Expected a non-nil error value combining a body with data fields!")
+	}
+}
+
+func TestPastedBody(t *testing.T) {
+	term := &captureConsole{input: []string{"first line", "  second line", "END", "get /after"}}
+
+	spec, err := parseRequestTokens("PUT", []string{"/notes", "<<", "END"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := spec.resolveBody(term); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if spec.body != "first line\n  second line" {
+		t.Fatalf("Expected the pasted lines, found %q", spec.body)
+	}
+	if len(term.input) != 1 {
+		t.Fatalf("Expected reading to stop at the sentinel, %v remain", term.input)
+	}
+
+	req, _ := spec.build(defaultConfig(), true)
+	if req.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("Expected a text/plain body, found %v", req.Header.Get("Content-Type"))
+	}
+
+	spec, _ = parseRequestTokens("PUT", []string{"/notes", "<<EOF"})
+	if err := spec.resolveBody(&captureConsole{input: []string{"never ended"}}); err == nil {
+		t.Fatalf("Expected a non-nil error value for a missing sentinel!")
+	}
+}
+
+func TestEditedBody(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+
+	//
+	// The "editor" appends to whatever it was given, so we can see it was prefilled
+	//
+	editor := filepath.Join(dir, "editor.sh")
+	ioutil.WriteFile(editor, []byte("#!/bin/sh\necho ',\"b\":2}' >> \"$1\"\n"), 0755)
+
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		saved, ok := os.LookupEnv(name)
+		defer func(name string) {
+			if ok {
+				os.Setenv(name, saved)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name)
+	}
+	os.Unsetenv("VISUAL")
+	os.Setenv("EDITOR", editor)
+
+	recentBodies["/edited"] = `{"a":1`
+	spec, err := parseRequestTokens("POST", []string{"/edited", "--edit"})
+	if err != nil || !spec.edit {
+		t.Fatalf("Expected --edit to be recognised: %v", err)
+	}
+	if err := spec.resolveBody(&captureConsole{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if spec.body != `{"a":1,"b":2}` {
+		t.Fatalf("Expected the edited body, found %q", spec.body)
+	}
+
+	os.Setenv("EDITOR", "false")
+	err = spec.resolveBody(&captureConsole{})
+	if err == nil || !strings.Contains(err.Error(), "false failed") {
+		t.Fatalf("Expected the editor's failure to be reported, found %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Insomnia refers to environment variables as {{ _.name }}
+var insomniaVariablePattern = regexp.MustCompile(`{{\s*_\.([A-Za-z0-9_.\-]+)\s*}}`)
+
+type insomniaPair struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Type     string `json:"type,omitempty"`
+	FileName string `json:"fileName,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+type insomniaBody struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []insomniaPair `json:"params"`
+	FileName string         `json:"fileName"`
+}
+
+type insomniaAuth struct {
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+	Token    string `json:"token"`
+	Prefix   string `json:"prefix"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	AddTo    string `json:"addTo"`
+}
+
+//
+// insomniaResource is one of the workspaces, folders (request groups), requests and environments
+// making up an Insomnia export, linked together by their parent IDs.
+//
+type insomniaResource struct {
+	ID             string                 `json:"_id"`
+	Type           string                 `json:"_type"`
+	ParentID       string                 `json:"parentId"`
+	Name           string                 `json:"name"`
+	Method         string                 `json:"method"`
+	URL            string                 `json:"url"`
+	Body           insomniaBody           `json:"body"`
+	Headers        []insomniaPair         `json:"headers"`
+	Parameters     []insomniaPair         `json:"parameters"`
+	Authentication insomniaAuth           `json:"authentication"`
+	Data           map[string]interface{} `json:"data"`
+}
+
+type insomniaExport struct {
+	Type      string              `json:"_type"`
+	Format    int                 `json:"__export_format"`
+	Resources []*insomniaResource `json:"resources"`
+}
+
+//
+// insomniaText converts Insomnia's {{ _.name }} variable references to acromantula's {{name}}.
+//
+func insomniaText(s string) string {
+	return insomniaVariablePattern.ReplaceAllString(s, "{{$1}}")
+}
+
+//
+// flattenInsomniaData turns an environment's data into variables, nested objects becoming names
+// such as 'auth.token' and anything other than a string being kept as JSON.
+//
+func flattenInsomniaData(prefix string, data map[string]interface{}, values map[string]string) {
+	for key, value := range data {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenInsomniaData(prefix+key+".", v, values)
+		case string:
+			values[prefix+key] = insomniaText(v)
+		default:
+			encoded, _ := json.Marshal(v)
+			values[prefix+key] = string(encoded)
+		}
+	}
+}
+
+func importedInsomniaVariables(values map[string]string) []importedVariable {
+	var imported []importedVariable
+	for _, key := range sortKeys(values) {
+		imported = append(imported, importedVariable{key, values[key]})
+	}
+	return imported
+}
+
+//
+// parseInsomnia reads an Insomnia v4 JSON export.  The base environment's variables are set on the
+// active configuration, and each sub environment becomes a configuration including the base's variables.
+//
+func parseInsomnia(data []byte) (*importedCollection, error) {
+	var export insomniaExport
+	err := json.Unmarshal(data, &export)
+	if err != nil {
+		return nil, fmt.Errorf("it isn't valid JSON: %v", err)
+	}
+	if export.Type != "export" || export.Format != 4 {
+		return nil, fmt.Errorf("only Insomnia v4 JSON exports can be imported")
+	}
+
+	resources := make(map[string]*insomniaResource, len(export.Resources))
+	imported := &importedCollection{}
+	for _, r := range export.Resources {
+		resources[r.ID] = r
+		if r.Type == "workspace" && len(imported.name) == 0 {
+			imported.name = importedName(r.Name, defaultCollection)
+		}
+	}
+
+	base := map[string]string{}
+	var subEnvironments []*insomniaResource
+	for _, r := range export.Resources {
+		switch r.Type {
+		case "environment":
+			if parent := resources[r.ParentID]; parent != nil && parent.Type == "environment" {
+				subEnvironments = append(subEnvironments, r)
+			} else {
+				flattenInsomniaData("", r.Data, base)
+			}
+		case "request":
+			req := imported.insomniaRequest(r)
+			imported.add(insomniaFolder(resources, r.ParentID), r.Name, req)
+		}
+	}
+
+	imported.variables = importedInsomniaVariables(base)
+	for _, env := range subEnvironments {
+		values := map[string]string{}
+		for k, v := range base {
+			values[k] = v
+		}
+		flattenInsomniaData("", env.Data, values)
+		imported.environments = append(imported.environments,
+			importedEnvironment{name: env.Name, values: importedInsomniaVariables(values)})
+	}
+
+	return imported, nil
+}
+
+//
+// insomniaFolder is the path of the request group with the given ID, including the groups above it.
+//
+func insomniaFolder(resources map[string]*insomniaResource, id string) string {
+	r := resources[id]
+	if r == nil || r.Type != "request_group" {
+		return ""
+	}
+	return joinFolder(insomniaFolder(resources, r.ParentID), r.Name)
+}
+
+func (c *importedCollection) insomniaRequest(res *insomniaResource) *savedRequest {
+	r := &savedRequest{Method: strings.ToUpper(res.Method), URL: insomniaText(res.URL)}
+	if len(r.Method) == 0 {
+		r.Method = "GET"
+	}
+
+	for _, h := range res.Headers {
+		if !h.Disabled && len(h.Name) > 0 {
+			r.Items = append(r.Items, h.Name+":"+insomniaText(h.Value))
+		}
+	}
+	for _, p := range res.Parameters {
+		if !p.Disabled && len(p.Name) > 0 {
+			r.Items = append(r.Items, p.Name+"=="+insomniaText(p.Value))
+		}
+	}
+
+	auth := res.Authentication
+	if !auth.Disabled {
+		switch auth.Type {
+		case "", "none":
+		case "bearer":
+			prefix := auth.Prefix
+			if len(prefix) == 0 {
+				prefix = "Bearer"
+			}
+			r.Items = append(r.Items, "Authorization:"+prefix+" "+insomniaText(auth.Token))
+		case "basic":
+			c.basicAuth(res.Name, r, insomniaText(auth.Username), insomniaText(auth.Password))
+		case "apikey":
+			if auth.AddTo == "queryParams" {
+				r.Items = append(r.Items, auth.Key+"=="+insomniaText(auth.Value))
+			} else {
+				r.Items = append(r.Items, auth.Key+":"+insomniaText(auth.Value))
+			}
+		default:
+			c.warn("%s uses %s authentication, which can't be imported", res.Name, auth.Type)
+		}
+	}
+
+	body := res.Body
+	switch {
+	case body.MimeType == "application/x-www-form-urlencoded":
+		var fields [][2]string
+		for _, p := range body.Params {
+			if !p.Disabled {
+				fields = append(fields, [2]string{p.Name, insomniaText(p.Value)})
+			}
+		}
+		r.Body = formEncode(fields)
+		setContentType(r, body.MimeType)
+	case body.MimeType == "multipart/form-data":
+		//
+		// Insomnia adds a Content-Type header of its own, which would lose the boundary of the body sent
+		//
+		var items []string
+		for _, token := range r.Items {
+			if !strings.HasPrefix(strings.ToLower(token), "content-type:") {
+				items = append(items, token)
+			}
+		}
+		r.Items = items
+
+		r.Multipart = true
+		for _, p := range body.Params {
+			if p.Disabled {
+				continue
+			}
+			if p.Type == "file" {
+				r.Items = append(r.Items, p.Name+"@"+p.FileName)
+			} else {
+				r.Items = append(r.Items, p.Name+"="+insomniaText(p.Value))
+			}
+		}
+	case len(body.FileName) > 0:
+		r.BodyFile = body.FileName
+	case len(body.Text) > 0:
+		r.Body = insomniaText(body.Text)
+		if body.MimeType == "application/graphql" {
+			setContentType(r, "application/json")
+		} else if len(body.MimeType) > 0 {
+			setContentType(r, body.MimeType)
+		}
+	}
+
+	if strings.Contains(r.URL+r.Body+strings.Join(r.Items, ""), "{%") {
+		c.warn("%s uses Insomnia template tags, which acromantula doesn't support", res.Name)
+	}
+	return r
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseInsomnia(t *testing.T) {
+	pwd, _ := os.Getwd()
+	data, _ := ioutil.ReadFile(filepath.Join(pwd, "tests/insomnia/shop.json"))
+	imported, err := parseInsomnia(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []*savedRequest{
+		{Name: "Log-in", Folder: "Auth", Method: "POST", URL: "{{baseUrl}}/login",
+			Items: []string{"Content-Type:application/json"}, Body: `{"user": "bob", "password": "{{auth.password}}"}`},
+		{Name: "List-items", Method: "GET", URL: "{{baseUrl}}/items", Items: []string{"page==2", "Authorization:Bearer {{token}}"}},
+		{Name: "Upload", Method: "PUT", URL: "{{baseUrl}}/upload", Multipart: true,
+			Items: []string{"Authorization:Basic Ym9iOnNlY3JldA==", "note=hello", "file@/tmp/upload.txt"}},
+	}
+	if imported.name != "Shop-API" || !reflect.DeepEqual(imported.requests, expected) {
+		t.Fatalf("Unexpected requests in %v", imported.name)
+	}
+
+	base := []importedVariable{{"auth.password", "hunter2"}, {"baseUrl", "http://localhost:8080"}}
+	if !reflect.DeepEqual(imported.variables, base) {
+		t.Fatalf("Expected %v, found %v", base, imported.variables)
+	}
+
+	production := importedEnvironment{name: "Production", values: []importedVariable{
+		{"auth.password", "hunter2"}, {"baseUrl", "https://api.example.com"}, {"retries", "3"}}}
+	if len(imported.environments) != 1 || !reflect.DeepEqual(imported.environments[0], production) {
+		t.Fatalf("Expected %v, found %v", production, imported.environments)
+	}
+
+	if _, err := parseInsomnia([]byte(`{"_type": "export", "__export_format": 3, "resources": []}`)); err == nil {
+		t.Fatalf("Expected a non-nil error value for an old export!")
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+type lastCommand struct{}
+
+func (c *lastCommand) description() string {
+	return "Shows, saves or replays the last request and response, '!!' repeats the last request"
+}
+
+func (c *lastCommand) usage() string {
+	return "[show] | [request] | [headers] | [body] | [timing] | [save <file>] | [replay] | [query <query>]"
+}
+
+func (c *lastCommand) exec(tokens []string, term console, config *configuration) {
+	option := "show"
+	if len(tokens) > 1 {
+		option = tokens[1]
+	}
+
+	switch option {
+	case "replay":
+		replayRequest(term)
+		return
+	case "request":
+		if lastRequest == nil {
+			term.printf("No request has been sent yet\n")
+			failures++
+			return
+		}
+		printRecordedRequest(term, lastRequest)
+		return
+	}
+
+	if lastResponse == nil {
+		term.printf("No response has been received yet\n")
+		failures++
+		return
+	}
+
+	raw := boolSettingValue(config.settings.Settings, "raw-output", false)
+	contentType := lastResponse.header.Get("Content-Type")
+
+	switch option {
+	case "show":
+		if lastResponse.request != nil {
+			printRecordedRequest(term, lastResponse.request)
+			term.writeString("\n")
+		}
+		term.underscore()
+		term.printf("HTTP %v\n", lastResponse.status)
+		term.reset()
+		printHeaders(" < ", term, lastResponse.header)
+		if len(lastResponse.savedTo) > 0 {
+			term.printf("\nThe body was saved to %s\n", lastResponse.savedTo)
+		} else {
+			printResponse(term, contentType, lastResponse.body, raw)
+		}
+		if lastResponse.timing != nil {
+			term.writeString("\n")
+			printTiming(" ~ ", term, lastResponse.timing)
+		}
+	case "headers":
+		term.printf("HTTP %v\n", lastResponse.status)
+		printHeaders(" < ", term, lastResponse.header)
+	case "body":
+		if !bodyKept(term) {
+			return
+		}
+		renderBody(term, contentType, lastResponse.body, raw)
+		term.writeString("\n")
+	case "timing":
+		if lastResponse.timing != nil {
+			printTiming(" ~ ", term, lastResponse.timing)
+		}
+	case "save":
+		if len(tokens) < 3 {
+			term.printf("Please supply a file name, such as '%s save response.json'\n", tokens[0])
+			failures++
+			return
+		}
+		if !bodyKept(term) {
+			return
+		}
+		err := ioutil.WriteFile(tokens[2], lastResponse.body, 0644)
+		if err != nil {
+			term.printf("Couldn't save the response: %v\n", err)
+			failures++
+			return
+		}
+		term.printf("Saved %d bytes to %s\n", len(lastResponse.body), tokens[2])
+	case "query":
+		if len(tokens) < 3 {
+			term.printf("Please supply a query, such as '%s query .items[].id'\n", tokens[0])
+			failures++
+			return
+		}
+		if !bodyKept(term) {
+			return
+		}
+		printQuery(term, lastResponse.body, strings.Join(tokens[2:], " "))
+	default:
+		term.printf("Unknown option '%s', try one of [show, request, headers, body, timing, save, replay, query]\n", tokens[1])
+		failures++
+	}
+}
+
+func (c *lastCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return []string{"show", "request", "headers", "body", "timing", "save", "replay", "query"}
+	}
+	return nil
+}
+
+//
+// printRecordedRequest shows the method, URL and headers a request was sent with.
+//
+func printRecordedRequest(term console, r *recordedRequest) {
+	term.underscore()
+	term.printf("%v %v\n", r.method, r.url)
+	term.reset()
+	printHeaders(" > ", term, r.header)
+}
+
+//
+// bodyKept reports a failure if the last response's body was streamed to a file, so wasn't kept.
+//
+func bodyKept(term console) bool {
+	if len(lastResponse.savedTo) > 0 {
+		term.printf("The body of the last response was saved to %s rather than kept\n", lastResponse.savedTo)
+		failures++
+		return false
+	}
+	return true
+}
+
+//
+// replayCommand repeats the last request, it's registered as '!!'.
+//
+type replayCommand struct{}
+
+func (c *replayCommand) description() string {
+	return "Repeats the last request"
+}
+
+func (c *replayCommand) usage() string {
+	return ""
+}
+
+func (c *replayCommand) exec(tokens []string, term console, config *configuration) {
+	replayRequest(term)
+}
+
+//
+// replayRequest sends the last request again, exactly as it was sent before.  Variables, headers
+// and params aren't re-applied, so changes to the configuration don't affect it.
+//
+func replayRequest(term console) {
+	if lastRequest == nil {
+		term.printf("No request has been sent yet\n")
+		failures++
+		return
+	}
+
+	req, err := lastRequest.build()
+	if err != nil {
+		term.printf("Couldn't rebuild the request: %v\n", err)
+		failures++
+		return
+	}
+
+	err = doRequest(term, req, lastRequest.options)
+	if err != nil {
+		term.printf("Error performing %s: %v\n", req.Method, err)
+		failures++
+	}
+}
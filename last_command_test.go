@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLastAndReplay(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.Method+" "+string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(fmt.Sprintf(`{"count":%d}`, len(received))))
+	}))
+	defer server.Close()
+
+	savedConfig, savedTerm := config, term
+	defer func() { config, term = savedConfig, savedTerm }()
+	config = defaultConfig()
+	lastRequest, lastResponse = nil, nil
+	capture := &captureConsole{}
+	term = capture
+
+	last := &lastCommand{}
+	last.exec([]string{"last", "replay"}, capture, config)
+	if !strings.Contains(capture.String(), "No request") {
+		t.Fatalf("Expected no request to replay, found %v", capture.String())
+	}
+
+	post := &httpBodyCommand{method: "POST"}
+	post.exec([]string{"post", server.URL, "name=x"}, capture, config)
+
+	capture.Reset()
+	last.exec([]string{"last", "body"}, capture, config)
+	if capture.String() != "{\n  \"count\": 1\n}\n" {
+		t.Fatalf("Expected the last body, found %q", capture.String())
+	}
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	last.exec([]string{"last", "save", filepath.Join(dir, "out.json")}, capture, config)
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "out.json")); string(data) != `{"count":1}` {
+		t.Fatalf("Expected the body to be saved, found %v", string(data))
+	}
+
+	(&replayCommand{}).exec([]string{"!!"}, capture, config)
+	if len(received) != 2 || received[0] != received[1] || received[1] != `POST {"name":"x"}` {
+		t.Fatalf("Expected the request to be repeated exactly, found %v", received)
+	}
+	if lastResponse == nil || !strings.Contains(string(lastResponse.body), `"count":2`) {
+		t.Fatalf("Expected the replayed response to be kept")
+	}
+
+	capture.Reset()
+	last.exec([]string{"last", "headers"}, capture, config)
+	if !strings.HasPrefix(capture.String(), "HTTP 200 OK\n") || !strings.Contains(capture.String(), "Content-Type") {
+		t.Fatalf("Expected the last headers, found %v", capture.String())
+	}
+}
+
+func TestLastRequestAndSavedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("spider"))
+	}))
+	defer server.Close()
+
+	savedConfig, savedTerm := config, term
+	defer func() { config, term = savedConfig, savedTerm }()
+	config = defaultConfig()
+	lastRequest, lastResponse = nil, nil
+	capture := &captureConsole{}
+	term = capture
+
+	last := &lastCommand{}
+	(&httpCommand{method: "GET"}).exec([]string{"get", server.URL + "/web", "X-Id:42"}, capture, config)
+
+	for _, option := range []string{"request", "show"} {
+		capture.Reset()
+		last.exec([]string{"last", option}, capture, config)
+		if !strings.Contains(capture.String(), "GET "+server.URL+"/web") || !strings.Contains(capture.String(), "X-Id : [42]") {
+			t.Fatalf("Expected 'last %s' to show the request, found %v", option, capture.String())
+		}
+	}
+
+	//
+	// A body streamed to a file isn't kept, so it can't be saved again
+	//
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "web.txt")
+	(&httpCommand{method: "GET"}).exec([]string{"get", server.URL + "/web", ">", out}, capture, config)
+
+	before := failures
+	capture.Reset()
+	last.exec([]string{"last", "save", filepath.Join(dir, "again.txt")}, capture, config)
+	if failures == before || !strings.Contains(capture.String(), "saved to "+out) {
+		t.Fatalf("Expected last save to report where the body went, found %v", capture.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "again.txt")); err == nil {
+		t.Fatalf("Didn't expect an empty file to be written")
+	}
+}
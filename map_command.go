@@ -24,6 +24,19 @@ import "fmt"
 type mapCommand struct {
 	desc       string
 	backingMap map[string]string
+
+	// Keys offered for completion in addition to those already in the map
+	suggestions []string
+
+	// Optional check of a value before it is set
+	validate func(key, value string) error
+}
+
+func (c *mapCommand) check(key, value string) error {
+	if c.validate == nil {
+		return nil
+	}
+	return c.validate(key, value)
 }
 
 func (c *mapCommand) description() string {
@@ -34,7 +47,7 @@ func (c *mapCommand) usage() string {
 	return fmt.Sprintf("[set <key> <value>] | [unset <key>]")
 }
 
-func (c *mapCommand) exec(tokens []string, term *Term, config *configuration) {
+func (c *mapCommand) exec(tokens []string, term console, config *configuration) {
 
 	//
 	// If only the top level command is specified, then we simply print the
@@ -51,14 +64,20 @@ func (c *mapCommand) exec(tokens []string, term *Term, config *configuration) {
 	case "set":
 		if len(tokens) < 3 {
 			term.printf("No name/value supplied, try '%s set <name> <value>'\n", tokens[0])
+			failures++
 		} else if len(tokens) < 4 {
 			term.printf("%s needs a value as well, try '%s set %s <value>'\n", tokens[2], tokens[0], tokens[2])
+			failures++
+		} else if err := c.check(tokens[2], tokens[3]); err != nil {
+			term.printf("%v\n", err)
+			failures++
 		} else {
 			c.backingMap[tokens[2]] = tokens[3]
 		}
 	case "unset":
 		if len(tokens) < 3 {
 			term.printf("No key supplied, try '%s unset <name> [name...]'\n", tokens[0])
+			failures++
 		} else {
 			for _, key := range tokens[2:] {
 				delete(c.backingMap, key)
@@ -66,5 +85,22 @@ func (c *mapCommand) exec(tokens []string, term *Term, config *configuration) {
 		}
 	default:
 		term.printf("Unknown sub-command '%s', try one of [set, unset]\n", tokens[1])
+		failures++
+	}
+}
+
+func (c *mapCommand) complete(tokens []string) []string {
+	if len(tokens) == 2 {
+		return []string{"set", "unset"}
+	}
+
+	switch tokens[1] {
+	case "set":
+		if len(tokens) == 3 {
+			return append(sortKeys(c.backingMap), c.suggestions...)
+		}
+	case "unset":
+		return sortKeys(c.backingMap)
 	}
+	return nil
 }
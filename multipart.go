@@ -0,0 +1,199 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+//
+// multipartBody is a multipart/form-data body made up of in-memory segments (boundaries, headers and
+// field values) and files, which are only opened as they're sent.  Knowing the size of every
+// segment up front means the body can be streamed with a correct Content-Length.
+//
+type multipartBody struct {
+	contentType string
+	segments    []multipartSegment
+	size        int64
+}
+
+type multipartSegment struct {
+	data []byte
+	file string
+}
+
+//
+// newMultipartBody builds a body from the request's data items and files, along with any extra
+// fields (such as the configuration's params).  A file item may specify its Content-Type as
+// field@path;type=mime, otherwise it is looked up from the file's extension.
+//
+func newMultipartBody(items []requestItem, fields map[string]string) (*multipartBody, error) {
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+	body := &multipartBody{contentType: writer.FormDataContentType()}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writer.WriteField(k, fields[k])
+	}
+
+	for _, item := range items {
+		switch item.kind {
+		case dataItem, rawJSONItem:
+			writer.WriteField(item.key, item.value)
+		case fileDataItem:
+			path, contentType := splitFileType(item.value)
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %v: %v", path, err)
+			}
+			if info.IsDir() {
+				return nil, fmt.Errorf("cannot read %v: not a regular file", path)
+			}
+
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				quoteEscaper.Replace(item.key), quoteEscaper.Replace(filepath.Base(path))))
+			header.Set("Content-Type", contentType)
+			writer.CreatePart(header)
+
+			//
+			// Everything written so far becomes a segment, followed by the file itself
+			//
+			body.add(buf.Bytes())
+			buf.Reset()
+			body.segments = append(body.segments, multipartSegment{file: path})
+			body.size += info.Size()
+		}
+	}
+
+	writer.Close()
+	body.add(buf.Bytes())
+	return body, nil
+}
+
+func (b *multipartBody) add(data []byte) {
+	if len(data) > 0 {
+		b.segments = append(b.segments, multipartSegment{data: append([]byte(nil), data...)})
+		b.size += int64(len(data))
+	}
+}
+
+//
+// splitFileType separates an optional ;type=mime from a file item's path.
+//
+func splitFileType(value string) (string, string) {
+	if i := strings.LastIndex(value, ";type="); i >= 0 {
+		return value[:i], value[i+len(";type="):]
+	}
+
+	contentType := contentTypes[strings.TrimPrefix(filepath.Ext(value), ".")]
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	return value, contentType
+}
+
+//
+// open returns a reader over the whole body, files are opened as they're reached.
+//
+func (b *multipartBody) open() (io.ReadCloser, error) {
+	reader := &multipartReader{}
+	readers := make([]io.Reader, len(b.segments))
+	for i, segment := range b.segments {
+		if len(segment.file) > 0 {
+			readers[i] = &lazyFile{path: segment.file, owner: reader}
+		} else {
+			readers[i] = bytes.NewReader(segment.data)
+		}
+	}
+	reader.Reader = io.MultiReader(readers...)
+	return reader, nil
+}
+
+//
+// attach makes this the request's body.
+//
+func (b *multipartBody) attach(req *http.Request) error {
+	body, err := b.open()
+	if err != nil {
+		return err
+	}
+
+	req.Body = body
+	req.GetBody = b.open
+	req.ContentLength = b.size
+	return nil
+}
+
+//
+// multipartReader closes whichever file is open when the body is closed early.
+//
+type multipartReader struct {
+	io.Reader
+	current *os.File
+}
+
+func (r *multipartReader) Close() error {
+	if r.current != nil {
+		r.current.Close()
+		r.current = nil
+	}
+	return nil
+}
+
+//
+// lazyFile opens its file on the first read and closes it at the end.
+//
+type lazyFile struct {
+	path  string
+	file  *os.File
+	owner *multipartReader
+}
+
+func (l *lazyFile) Read(p []byte) (int, error) {
+	if l.file == nil {
+		file, err := os.Open(l.path)
+		if err != nil {
+			return 0, err
+		}
+		l.file = file
+		l.owner.current = file
+	}
+
+	n, err := l.file.Read(p)
+	if err == io.EOF {
+		l.file.Close()
+		l.owner.current = nil
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultipartRequest(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	report := filepath.Join(dir, "report.pdf")
+	notes := filepath.Join(dir, "notes")
+	ioutil.WriteFile(report, []byte("%PDF-1.4 pretend"), 0644)
+	ioutil.WriteFile(notes, []byte("some notes"), 0644)
+
+	var form *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1024 * 1024); err != nil {
+			t.Errorf("Couldn't parse the form: %v", err)
+		}
+		form = r
+	}))
+	defer server.Close()
+
+	config := defaultConfig()
+	config.settings.Params["token"] = "abc"
+
+	spec, err := parseRequestTokens("POST", []string{server.URL + "/upload", "--multipart", "title=Q1", "doc@" + report,
+		"extra@" + notes + ";type=text/markdown"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// An absolute URL doesn't get the configuration's params, so use a relative one with a root
+	config.settings.Settings["root"] = server.URL
+	spec.url = "/upload"
+
+	req, err := spec.build(config, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data; boundary=") || req.ContentLength <= 0 {
+		t.Fatalf("Expected a multipart body with a length, found %v and %d", req.Header.Get("Content-Type"), req.ContentLength)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	response.Body.Close()
+
+	if form.FormValue("title") != "Q1" || form.FormValue("token") != "abc" {
+		t.Fatalf("Expected the title and token fields, found %v", form.MultipartForm.Value)
+	}
+
+	expected := map[string]string{"doc": "application/pdf", "extra": "text/markdown"}
+	for field, contentType := range expected {
+		files := form.MultipartForm.File[field]
+		if len(files) != 1 || files[0].Header.Get("Content-Type") != contentType {
+			t.Fatalf("Expected %v to be sent as %v, found %v", field, contentType, files)
+		}
+	}
+	if form.MultipartForm.File["doc"][0].Filename != "report.pdf" {
+		t.Fatalf("Expected the file name to be sent, found %v", form.MultipartForm.File["doc"][0].Filename)
+	}
+
+	//
+	// GetBody must produce the same body again, for redirects and replays
+	//
+	first, _ := req.GetBody()
+	second, _ := req.GetBody()
+	a, _ := ioutil.ReadAll(first)
+	b, _ := ioutil.ReadAll(second)
+	if string(a) != string(b) || int64(len(a)) != req.ContentLength {
+		t.Fatalf("Expected GetBody to recreate the %d byte body", req.ContentLength)
+	}
+
+	spec, _ = parseRequestTokens("POST", []string{"/upload", "--multipart", "doc@" + filepath.Join(dir, "missing")})
+	if _, err := spec.build(config, true); err == nil {
+		t.Fatalf("Expected a non-nil error value for a missing file!")
+	}
+}
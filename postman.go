@@ -0,0 +1,591 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Given to export, these write a collection or configuration in Postman's format rather than a single request
+const postmanFormat = "postman"
+const postmanEnvironmentFormat = "postman-env"
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// Content-Types for the languages a raw Postman body may be written in
+var postmanLanguages = map[string]string{
+	"json":       "application/json",
+	"xml":        "application/xml",
+	"html":       "text/html",
+	"javascript": "application/javascript",
+}
+
+//
+// postmanValue accepts any JSON value, as Postman doesn't always quote numbers and booleans.
+//
+type postmanValue string
+
+func (v *postmanValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = postmanValue(s)
+	} else if string(data) != "null" {
+		*v = postmanValue(data)
+	}
+	return nil
+}
+
+type postmanPair struct {
+	Key      string       `json:"key"`
+	Value    postmanValue `json:"value"`
+	Type     string       `json:"type,omitempty"`
+	Src      interface{}  `json:"src,omitempty"`
+	Disabled bool         `json:"disabled,omitempty"`
+}
+
+//
+// postmanVariable is a collection variable or an environment value, which are switched off in different ways.
+//
+type postmanVariable struct {
+	Key      string       `json:"key"`
+	Value    postmanValue `json:"value"`
+	Enabled  *bool        `json:"enabled,omitempty"`
+	Disabled bool         `json:"disabled,omitempty"`
+}
+
+type postmanEnvironment struct {
+	Name   string            `json:"name"`
+	Values []postmanVariable `json:"values"`
+	Scope  string            `json:"_postman_variable_scope,omitempty"`
+}
+
+type postmanInfo struct {
+	Name   string `json:"name"`
+	Schema string `json:"schema"`
+}
+
+type postmanCollection struct {
+	Info     *postmanInfo      `json:"info"`
+	Item     []*postmanItem    `json:"item"`
+	Variable []postmanVariable `json:"variable,omitempty"`
+	Auth     *postmanAuth      `json:"auth,omitempty"`
+}
+
+//
+// postmanItem is either a folder of further items or a single request.
+//
+type postmanItem struct {
+	Name    string            `json:"name"`
+	Item    []*postmanItem    `json:"item,omitempty"`
+	Request *postmanRequest   `json:"request,omitempty"`
+	Auth    *postmanAuth      `json:"auth,omitempty"`
+	Event   []json.RawMessage `json:"event,omitempty"`
+}
+
+type postmanRequest struct {
+	Method string        `json:"method"`
+	Header []postmanPair `json:"header"`
+	URL    postmanURL    `json:"url"`
+	Body   *postmanBody  `json:"body,omitempty"`
+	Auth   *postmanAuth  `json:"auth,omitempty"`
+}
+
+//
+// A request may be given as nothing more than its URL.
+//
+func (r *postmanRequest) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		r.Method, r.URL.Raw = "GET", raw
+		return nil
+	}
+
+	type plain postmanRequest
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+//
+// postmanURL may be a plain string, or an object holding the URL along with the values of its
+// :name path variables.
+//
+type postmanURL struct {
+	Raw      string        `json:"raw"`
+	Variable []postmanPair `json:"variable,omitempty"`
+}
+
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &u.Raw); err == nil {
+		return nil
+	}
+
+	type plain postmanURL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+func (u postmanURL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.Raw)
+}
+
+//
+// String is the URL with any path variables filled in.
+//
+func (u postmanURL) String() string {
+	path, rest := u.Raw, ""
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path, rest = path[:i], path[i:]
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		for _, v := range u.Variable {
+			if segment == ":"+v.Key {
+				segments[i] = string(v.Value)
+			}
+		}
+	}
+	return strings.Join(segments, "/") + rest
+}
+
+type postmanBody struct {
+	Mode       string          `json:"mode"`
+	Raw        string          `json:"raw,omitempty"`
+	URLEncoded []postmanPair   `json:"urlencoded,omitempty"`
+	FormData   []postmanPair   `json:"formdata,omitempty"`
+	File       *postmanFile    `json:"file,omitempty"`
+	GraphQL    *postmanGraphQL `json:"graphql,omitempty"`
+	Options    *postmanOptions `json:"options,omitempty"`
+	Disabled   bool            `json:"disabled,omitempty"`
+}
+
+type postmanFile struct {
+	Src string `json:"src"`
+}
+
+type postmanGraphQL struct {
+	Query     string `json:"query"`
+	Variables string `json:"variables,omitempty"`
+}
+
+type postmanOptions struct {
+	Raw struct {
+		Language string `json:"language"`
+	} `json:"raw"`
+}
+
+type postmanAuth struct {
+	Type   string        `json:"type"`
+	Bearer []postmanPair `json:"bearer,omitempty"`
+	Basic  []postmanPair `json:"basic,omitempty"`
+	APIKey []postmanPair `json:"apikey,omitempty"`
+}
+
+//
+// attributes are the settings of the auth's type, such as a bearer token.
+//
+func (a *postmanAuth) attributes() map[string]string {
+	pairs := map[string][]postmanPair{"bearer": a.Bearer, "basic": a.Basic, "apikey": a.APIKey}[a.Type]
+	attributes := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		attributes[p.Key] = string(p.Value)
+	}
+	return attributes
+}
+
+func importedPostmanVariables(vars []postmanVariable) []importedVariable {
+	var imported []importedVariable
+	for _, v := range vars {
+		if !v.Disabled && (v.Enabled == nil || *v.Enabled) {
+			imported = append(imported, importedVariable{v.Key, string(v.Value)})
+		}
+	}
+	return imported
+}
+
+//
+// parsePostman reads a Postman v2.1 collection, or an environment or globals file.  Globals are set on
+// the active configuration, like a collection's variables.
+//
+func parsePostman(data []byte) (*importedCollection, error) {
+	var env postmanEnvironment
+	err := json.Unmarshal(data, &env)
+	if err != nil {
+		return nil, fmt.Errorf("it isn't valid JSON: %v", err)
+	}
+
+	if env.Values != nil {
+		imported := &importedCollection{}
+		values := importedPostmanVariables(env.Values)
+		if env.Scope == "globals" {
+			imported.variables = values
+		} else {
+			imported.environments = []importedEnvironment{{name: env.Name, values: values}}
+		}
+		return imported, nil
+	}
+
+	var coll postmanCollection
+	err = json.Unmarshal(data, &coll)
+	if err != nil {
+		return nil, fmt.Errorf("it isn't a Postman collection: %v", err)
+	}
+	if coll.Info == nil || coll.Item == nil {
+		return nil, fmt.Errorf("it isn't a Postman collection or environment")
+	}
+	if !strings.Contains(coll.Info.Schema, "/v2.") {
+		return nil, fmt.Errorf("only Postman v2.1 collections can be imported, this is %s", coll.Info.Schema)
+	}
+
+	imported := &importedCollection{name: importedName(coll.Info.Name, defaultCollection)}
+	imported.variables = importedPostmanVariables(coll.Variable)
+	scripts := imported.addPostmanItems("", coll.Item, coll.Auth)
+	if scripts > 0 {
+		imported.warn("Ignored the scripts of %d requests or folders", scripts)
+	}
+	return imported, nil
+}
+
+//
+// addPostmanItems adds the requests within items to the collection, recursing into folders.  Requests
+// without auth of their own use the auth of their folder or collection.  The number of items with
+// scripts, which can't be imported, is returned.
+//
+func (c *importedCollection) addPostmanItems(folder string, items []*postmanItem, auth *postmanAuth) int {
+	scripts := 0
+	for _, item := range items {
+		if len(item.Event) > 0 {
+			scripts++
+		}
+
+		if item.Request == nil {
+			folderAuth := auth
+			if item.Auth != nil && item.Auth.Type != "inherit" {
+				folderAuth = item.Auth
+			}
+			scripts += c.addPostmanItems(joinFolder(folder, item.Name), item.Item, folderAuth)
+			continue
+		}
+
+		req := item.Request
+		r := &savedRequest{Method: strings.ToUpper(req.Method), URL: req.URL.String()}
+		if len(r.Method) == 0 {
+			r.Method = "GET"
+		}
+
+		for _, h := range req.Header {
+			if !h.Disabled {
+				r.Items = append(r.Items, h.Key+":"+string(h.Value))
+			}
+		}
+
+		requestAuth := auth
+		if req.Auth != nil && req.Auth.Type != "inherit" {
+			requestAuth = req.Auth
+		}
+		c.postmanAuth(item.Name, r, requestAuth)
+
+		if req.Body != nil && !req.Body.Disabled {
+			c.postmanBody(item.Name, r, req.Body)
+		}
+		c.add(folder, item.Name, r)
+	}
+	return scripts
+}
+
+func (c *importedCollection) postmanAuth(name string, r *savedRequest, auth *postmanAuth) {
+	if auth == nil {
+		return
+	}
+
+	attributes := auth.attributes()
+	switch auth.Type {
+	case "noauth", "inherit":
+	case "bearer":
+		r.Items = append(r.Items, "Authorization:Bearer "+attributes["token"])
+	case "basic":
+		c.basicAuth(name, r, attributes["username"], attributes["password"])
+	case "apikey":
+		if attributes["in"] == "query" {
+			r.Items = append(r.Items, attributes["key"]+"=="+attributes["value"])
+		} else {
+			r.Items = append(r.Items, attributes["key"]+":"+attributes["value"])
+		}
+	default:
+		c.warn("%s uses %s authentication, which can't be imported", name, auth.Type)
+	}
+}
+
+func (c *importedCollection) postmanBody(name string, r *savedRequest, body *postmanBody) {
+	switch body.Mode {
+	case "":
+	case "raw":
+		r.Body = body.Raw
+		if body.Options != nil && len(body.Raw) > 0 {
+			if contentType, ok := postmanLanguages[body.Options.Raw.Language]; ok {
+				setContentType(r, contentType)
+			}
+		}
+	case "urlencoded":
+		var fields [][2]string
+		for _, p := range body.URLEncoded {
+			if !p.Disabled {
+				fields = append(fields, [2]string{p.Key, string(p.Value)})
+			}
+		}
+		r.Body = formEncode(fields)
+		setContentType(r, "application/x-www-form-urlencoded")
+	case "formdata":
+		r.Multipart = true
+		for _, p := range body.FormData {
+			if p.Disabled {
+				continue
+			}
+			if p.Type != "file" {
+				r.Items = append(r.Items, p.Key+"="+string(p.Value))
+				continue
+			}
+
+			// Several files may be sent as one field, acromantula sends one file per item
+			srcs, ok := p.Src.([]interface{})
+			if !ok {
+				srcs = []interface{}{p.Src}
+			}
+			for _, src := range srcs {
+				if path, ok := src.(string); ok && len(path) > 0 {
+					r.Items = append(r.Items, p.Key+"@"+path)
+				}
+			}
+		}
+	case "file":
+		if body.File != nil {
+			r.BodyFile = body.File.Src
+		}
+	case "graphql":
+		if body.GraphQL == nil {
+			return
+		}
+		query := map[string]interface{}{"query": body.GraphQL.Query}
+		if json.Valid([]byte(body.GraphQL.Variables)) {
+			query["variables"] = json.RawMessage(body.GraphQL.Variables)
+		}
+		data, _ := json.Marshal(query)
+		r.Body = string(data)
+		setContentType(r, "application/json")
+	default:
+		c.warn("%s has a %s body, which can't be imported", name, body.Mode)
+	}
+}
+
+//
+// exportPostman writes the named collection as a Postman v2.1 collection.  Relative URLs are
+// made absolute with a {{root}} variable, which is set from the configuration.
+//
+func exportPostman(config *configuration, name string, redact bool) (string, error) {
+	coll, err := loadCollection(name)
+	if err != nil {
+		return "", err
+	}
+	if len(coll.Requests) == 0 {
+		return "", fmt.Errorf("The %s collection has no requests", name)
+	}
+
+	exported := &postmanCollection{Info: &postmanInfo{Name: name, Schema: postmanSchema}, Item: []*postmanItem{}}
+	folders := map[string]*postmanItem{}
+	relative := false
+
+	for _, r := range coll.Requests {
+		spec, err := r.spec()
+		if err != nil {
+			return "", err
+		}
+
+		req, err := postmanRequestFor(spec, redact)
+		if err != nil {
+			return "", fmt.Errorf("Couldn't export %s: %v", r.path(), err)
+		}
+		if !strings.Contains(spec.url, "://") && !strings.HasPrefix(spec.url, "{{") {
+			relative = true
+			req.URL.Raw = "{{root}}" + req.URL.Raw
+		}
+
+		item := &postmanItem{Name: r.Name, Request: req}
+		if len(r.Folder) == 0 {
+			exported.Item = append(exported.Item, item)
+		} else {
+			folder := postmanFolder(exported, folders, r.Folder)
+			folder.Item = append(folder.Item, item)
+		}
+	}
+
+	if relative {
+		exported.Variable = []postmanVariable{{Key: "root", Value: postmanValue(config.settings.Settings["root"])}}
+	}
+
+	return postmanJSON(exported)
+}
+
+//
+// postmanFolder finds (or creates) the folder item for path, along with any folders above it.
+//
+func postmanFolder(coll *postmanCollection, folders map[string]*postmanItem, path string) *postmanItem {
+	if folder, ok := folders[path]; ok {
+		return folder
+	}
+
+	folder := &postmanItem{Name: path, Item: []*postmanItem{}}
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		folder.Name = path[i+1:]
+		parent := postmanFolder(coll, folders, path[:i])
+		parent.Item = append(parent.Item, folder)
+	} else {
+		coll.Item = append(coll.Item, folder)
+	}
+	folders[path] = folder
+	return folder
+}
+
+//
+// postmanRequestFor converts spec into a Postman request, keeping any {{name}} references so
+// they can be filled in from a Postman environment.
+//
+func postmanRequestFor(spec *requestSpec, redact bool) (*postmanRequest, error) {
+	req := &postmanRequest{Method: spec.method, URL: postmanURL{Raw: spec.url}, Header: []postmanPair{}}
+
+	var query, fields []string
+	for _, item := range spec.items {
+		switch item.kind {
+		case headerItem:
+			value := item.value
+			for _, h := range redactedHeaders {
+				if redact && strings.EqualFold(item.key, h) {
+					value = redacted
+				}
+			}
+			req.Header = append(req.Header, postmanPair{Key: item.key, Value: postmanValue(value)})
+		case paramItem:
+			query = append(query, escapeOutsideVariables(item.key)+"="+escapeOutsideVariables(item.value))
+		}
+	}
+
+	if len(query) > 0 {
+		separator := "?"
+		if strings.Contains(spec.url, "?") {
+			separator = "&"
+		}
+		req.URL.Raw += separator + strings.Join(query, "&")
+	}
+
+	switch {
+	case spec.multipart:
+		body := &postmanBody{Mode: "formdata"}
+		for _, item := range spec.items {
+			switch item.kind {
+			case dataItem, rawJSONItem:
+				body.FormData = append(body.FormData, postmanPair{Key: item.key, Value: postmanValue(item.value), Type: "text"})
+			case fileDataItem:
+				path, _ := splitFileType(item.value)
+				body.FormData = append(body.FormData, postmanPair{Key: item.key, Type: "file", Src: path})
+			}
+		}
+		req.Body = body
+	case len(spec.bodyFile) > 0:
+		req.Body = &postmanBody{Mode: "file", File: &postmanFile{Src: spec.bodyFile}}
+	case len(spec.body) > 0:
+		req.Body = &postmanBody{Mode: "raw", Raw: spec.body}
+		if inlineContentType(spec.body) == "application/json" {
+			req.Body.Options = &postmanOptions{}
+			req.Body.Options.Raw.Language = "json"
+		}
+	default:
+		//
+		// Data items are written out as JSON by hand, so raw JSON items referring to variables survive
+		//
+		for _, item := range spec.items {
+			switch item.kind {
+			case dataItem:
+				value, _ := json.Marshal(item.value)
+				fields = append(fields, fmt.Sprintf("%q: %s", item.key, value))
+			case rawJSONItem:
+				fields = append(fields, fmt.Sprintf("%q: %s", item.key, item.value))
+			case fileDataItem:
+				data, err := ioutil.ReadFile(item.value)
+				if err != nil {
+					return nil, fmt.Errorf("cannot read %v: %v", item.value, err)
+				}
+				value, _ := json.Marshal(string(data))
+				fields = append(fields, fmt.Sprintf("%q: %s", item.key, value))
+			}
+		}
+		if len(fields) > 0 {
+			req.Body = &postmanBody{Mode: "raw", Raw: "{" + strings.Join(fields, ", ") + "}"}
+			req.Body.Options = &postmanOptions{}
+			req.Body.Options.Raw.Language = "json"
+			req.Header = append(req.Header, postmanPair{Key: "Content-Type", Value: "application/json"})
+		}
+	}
+
+	return req, nil
+}
+
+//
+// exportPostmanEnvironment writes a configuration's settings as a Postman environment.  acromantula's
+// own settings are left out, apart from root, which exported collections refer to.
+//
+func exportPostmanEnvironment(config *configuration, name string) (string, error) {
+	if name != config.name {
+		path, err := getConfigPath(name)
+		if err != nil {
+			return "", err
+		}
+		config, err = loadConfig(name, path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	enabled := true
+	env := &postmanEnvironment{Name: name, Values: []postmanVariable{}, Scope: "environment"}
+	keys := make([]string, 0, len(config.settings.Settings))
+	for key := range config.settings.Settings {
+		if _, known := knownSettings[key]; !known || key == "root" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		env.Values = append(env.Values, postmanVariable{Key: key, Value: postmanValue(config.settings.Settings[key]), Enabled: &enabled})
+	}
+
+	return postmanJSON(env)
+}
+
+//
+// postmanJSON indents v as Postman does, without escaping the &s found in so many URLs and bodies.
+//
+func postmanJSON(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	err := encoder.Encode(v)
+	return buf.String(), err
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePostmanCollection(t *testing.T) {
+	pwd, _ := os.Getwd()
+	data, _ := ioutil.ReadFile(filepath.Join(pwd, "tests/postman/shop.postman_collection.json"))
+	imported, err := parsePostman(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var paths []string
+	for _, r := range imported.requests {
+		paths = append(paths, r.path())
+	}
+	expected := []string{"Auth/Log-in", "Items/Get-item", "Items/Create-item", "Items/Upload-picture", "Health"}
+	if imported.name != "Shop-API" || !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v in Shop-API, found %v in %v", expected, paths, imported.name)
+	}
+
+	login := imported.requests[0]
+	if login.Body != "user=bob+smith&password={{password}}" ||
+		!reflect.DeepEqual(login.Items, []string{"Content-Type:application/x-www-form-urlencoded"}) {
+		t.Fatalf("Unexpected login request %+v", login)
+	}
+
+	get := imported.requests[1]
+	if get.URL != "{{baseUrl}}/items/42?fields=name" ||
+		!reflect.DeepEqual(get.Items, []string{"Accept:application/json", "Authorization:Bearer {{token}}"}) {
+		t.Fatalf("Unexpected get request %+v", get)
+	}
+
+	upload := imported.requests[3]
+	expected = []string{"api_key=={{apiKey}}", "caption=A spider", "picture@/tmp/spider.png"}
+	if !upload.Multipart || !reflect.DeepEqual(upload.Items, expected) {
+		t.Fatalf("Unexpected upload request %+v", upload)
+	}
+
+	if health := imported.requests[4]; health.Method != "GET" || health.URL != "{{baseUrl}}/health" {
+		t.Fatalf("Unexpected health request %+v", health)
+	}
+
+	variables := []importedVariable{{"baseUrl", "http://localhost:8080"}, {"legs", "8"}}
+	if !reflect.DeepEqual(imported.variables, variables) {
+		t.Fatalf("Expected %v, found %v", variables, imported.variables)
+	}
+	if len(imported.warnings) != 1 || !strings.Contains(imported.warnings[0], "scripts of 1") {
+		t.Fatalf("Expected a warning about scripts, found %v", imported.warnings)
+	}
+
+	for _, bad := range []string{`[]`, `{"info": {"name": "old"}, "item": [], "requests": []}`, `{"name": "x"}`} {
+		if _, err := parsePostman([]byte(bad)); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", bad)
+		}
+	}
+}
+
+func TestImportPostman(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	saved := config
+	defer func() { config = saved }()
+	config = defaultConfig()
+
+	pwd, _ := os.Getwd()
+	cmd := &importCommand{}
+	term := &captureConsole{}
+	before := failures
+	cmd.exec([]string{"import", "postman", filepath.Join(pwd, "tests/postman/shop.postman_collection.json"), "shop"}, term, config)
+	cmd.exec([]string{"import", "postman", filepath.Join(pwd, "tests/postman/staging.postman_environment.json")}, term, config)
+	if failures != before {
+		t.Fatalf("Unexpected failure: %v", term.String())
+	}
+
+	if config.settings.Settings["baseUrl"] != "http://localhost:8080" || config.settings.Settings["legs"] != "8" {
+		t.Fatalf("Expected the collection's variables to be set, found %v", config.settings.Settings)
+	}
+
+	path, _ := getConfigPath("Staging-EU")
+	staging, err := loadConfig("Staging-EU", path)
+	if err != nil {
+		t.Fatalf("Expected the environment to be saved as a configuration: %v", err)
+	}
+	settings := staging.settings.Settings
+	if settings["baseUrl"] != "https://staging.example.com" || settings["password"] != "secret" ||
+		len(settings["timeout"]) > 0 || len(settings["old"]) > 0 {
+		t.Fatalf("Unexpected settings %v", settings)
+	}
+	if !strings.Contains(term.String(), "timeout is one of acromantula's own settings") {
+		t.Fatalf("Expected the timeout to be skipped, found %v", term.String())
+	}
+
+	//
+	// The imported request is sent with the variables from the configuration
+	//
+	config.settings.Settings["baseUrl"] = server.URL
+	variables["token"] = "abc"
+	defer delete(variables, "token")
+	(&runRequestsCommand{}).exec([]string{"run", "shop:Items/Create-item"}, term, config)
+	if failures != before || body != `{"name": "spider", "legs": 8}` || auth != "Bearer abc" {
+		t.Fatalf("Unexpected request %v with %v (%v)", body, auth, term.String())
+	}
+}
+
+func TestImportActiveEnvironment(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	config := defaultConfig()
+	config.name = "Staging-EU"
+	config.settings.Settings["unsaved"] = "x"
+
+	pwd, _ := os.Getwd()
+	(&importCommand{}).exec([]string{"import", "postman", filepath.Join(pwd, "tests/postman/staging.postman_environment.json")}, &captureConsole{}, config)
+	if config.settings.Settings["baseUrl"] != "https://staging.example.com" {
+		t.Fatalf("Expected the environment to be set on the active configuration, found %v", config.settings.Settings)
+	}
+
+	//
+	// Only the environment's variables are saved, not other changes to the active configuration
+	//
+	path, _ := getConfigPath("Staging-EU")
+	saved, err := loadConfig("Staging-EU", path)
+	if err != nil || saved.settings.Settings["baseUrl"] != "https://staging.example.com" || len(saved.settings.Settings["unsaved"]) > 0 {
+		t.Fatalf("Unexpected saved settings %v (%v)", saved, err)
+	}
+}
+
+func TestExportPostman(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	config := defaultConfig()
+	config.name = "staging"
+	config.settings.Settings["root"] = "https://staging.example.com"
+	config.settings.Settings["token"] = "abc"
+	config.settings.Settings["timeout"] = "5s"
+
+	coll, _ := loadCollection("shop")
+	coll.put(&savedRequest{Name: "login", Folder: "auth", Method: "POST", URL: "/login", Items: []string{"user=bob", "age:={{age}}"}})
+	coll.put(&savedRequest{Name: "items", Method: "GET", URL: "{{api}}/items", Items: []string{"page==2", "Authorization:Bearer {{token}}"}})
+	coll.put(&savedRequest{Name: "upload", Folder: "items/pictures", Method: "PUT", URL: "/pictures", Items: []string{"caption=x", "file@/tmp/x.png"}, Multipart: true})
+	coll.write()
+
+	exported, err := exportPostman(config, "shop", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	//
+	// Importing the export again should give back the same requests
+	//
+	imported, err := parsePostman([]byte(exported))
+	if err != nil {
+		t.Fatalf("Couldn't import %v: %v", exported, err)
+	}
+
+	expected := []*savedRequest{
+		{Name: "login", Folder: "auth", Method: "POST", URL: "{{root}}/login",
+			Items: []string{"Content-Type:application/json"}, Body: `{"user": "bob", "age": {{age}}}`},
+		{Name: "items", Method: "GET", URL: "{{api}}/items?page=2", Items: []string{"Authorization:REDACTED"}},
+		{Name: "upload", Folder: "items/pictures", Method: "PUT", URL: "{{root}}/pictures",
+			Items: []string{"caption=x", "file@/tmp/x.png"}, Multipart: true},
+	}
+	if !reflect.DeepEqual(imported.requests, expected) {
+		t.Fatalf("Expected the same requests back, found %v", exported)
+	}
+	if !reflect.DeepEqual(imported.variables, []importedVariable{{"root", "https://staging.example.com"}}) {
+		t.Fatalf("Expected root as a variable, found %v", imported.variables)
+	}
+
+	exported, err = exportPostmanEnvironment(config, "staging")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	imported, _ = parsePostman([]byte(exported))
+	env := importedEnvironment{name: "staging", values: []importedVariable{{"root", "https://staging.example.com"}, {"token", "abc"}}}
+	if len(imported.environments) != 1 || !reflect.DeepEqual(imported.environments[0], env) {
+		t.Fatalf("Unexpected environment %v", exported)
+	}
+
+	if _, err := exportPostman(config, "missing", false); err == nil {
+		t.Fatalf("Expected a non-nil error value for an empty collection!")
+	}
+}
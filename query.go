@@ -0,0 +1,884 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//
+// queryValue runs a query, such as $.items[0].id or .items[] | .id, against already decoded JSON for
+// extract and .http request variables.  Several results are given as an array, while no result or
+// a null is an error.
+//
+func queryValue(data interface{}, query string) (interface{}, error) {
+	filter, err := compileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := filter(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(results) {
+	case 0:
+		return nil, fmt.Errorf("%s has no value", query)
+	case 1:
+		if results[0] == nil {
+			return nil, fmt.Errorf("%s is null or missing", query)
+		}
+		return results[0], nil
+	}
+	return results, nil
+}
+
+//
+// formatValue converts a decoded JSON value into a string, strings are returned as-is while everything
+// else is re-encoded as JSON.
+//
+func formatValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(bytes)
+}
+
+//
+// queryFilter is a compiled jq style filter, each input may produce any number of outputs.
+//
+type queryFilter func(input interface{}) ([]interface{}, error)
+
+type queryToken struct {
+	kind  byte // 'i'dentifier, 's'tring, 'n'umber or 'p'unctuation
+	text  string
+	value string
+}
+
+//
+// compileQuery parses a subset of jq: paths (.a.b, ."key", .[0], .[-1], .[1:3], .[]), pipes,
+// commas, comparisons, parentheses, literals and the functions in queryFunctions.  A trailing
+// ? suppresses errors from the preceding term, and a JSONPath style $ root is accepted too.
+//
+func compileQuery(query string) (queryFilter, error) {
+	tokens, err := lexQuery(jsonPathRoot(query))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	filter, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected '%s' in query", p.tokens[p.pos].text)
+	}
+	return filter, nil
+}
+
+//
+// jsonPathRoot converts JSONPath's root ($.items[0].id or $['key']) into jq's, so that either may be used.
+//
+func jsonPathRoot(query string) string {
+	query = strings.TrimSpace(query)
+	if !strings.HasPrefix(query, "$") {
+		return query
+	}
+
+	query = query[1:]
+	if !strings.HasPrefix(query, ".") {
+		query = "." + query
+	}
+	return query
+}
+
+//
+// runQuery compiles and runs query against a JSON document.
+//
+func runQuery(body []byte, query string) ([]interface{}, error) {
+	filter, err := compileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("Response isn't JSON: %v", err)
+	}
+	return filter(data)
+}
+
+//
+// decodeJSON keeps numbers as json.Number, so large IDs don't lose precision on the way through.
+//
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var data interface{}
+	err := decoder.Decode(&data)
+	return data, err
+}
+
+//
+// splitQuery separates an inline query from a command's tokens, everything after a '|' token is
+// the query.
+//
+func splitQuery(tokens []string) ([]string, string) {
+	for i, token := range tokens {
+		if token == "|" {
+			return tokens[:i], strings.Join(tokens[i+1:], " ")
+		}
+		if strings.HasPrefix(token, "|") {
+			return tokens[:i], strings.Join(append([]string{token[1:]}, tokens[i+1:]...), " ")
+		}
+	}
+	return tokens, ""
+}
+
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(query) && query[end] != c {
+				if query[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("Unterminated string in query")
+			}
+
+			//
+			// Single quotes aren't jq, but they save escaping double quotes on the command line
+			//
+			text := query[i : end+1]
+			if c == '\'' {
+				text = strconv.Quote(strings.Replace(text[1:len(text)-1], "\\'", "'", -1))
+			}
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("Bad string %s in query", query[i:end+1])
+			}
+			tokens = append(tokens, queryToken{kind: 's', text: query[i : end+1], value: value})
+			i = end + 1
+		case isDigit(c) || (c == '-' && i+1 < len(query) && isDigit(query[i+1])):
+			end := i + 1
+			for end < len(query) && (isDigit(query[end]) || query[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, queryToken{kind: 'n', text: query[i:end], value: query[i:end]})
+			i = end
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i + 1
+			for end < len(query) && (query[end] == '_' || isDigit(query[end]) || unicode.IsLetter(rune(query[end]))) {
+				end++
+			}
+			tokens = append(tokens, queryToken{kind: 'i', text: query[i:end], value: query[i:end]})
+			i = end
+		case i+1 < len(query) && isComparison(query[i:i+2]):
+			tokens = append(tokens, queryToken{kind: 'p', text: query[i : i+2]})
+			i += 2
+		case strings.IndexByte(".[]()|,:?<>", c) >= 0:
+			tokens = append(tokens, queryToken{kind: 'p', text: query[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("Unexpected '%c' in query", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isComparison(op string) bool {
+	return op == "==" || op == "!=" || op == "<=" || op == ">="
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return queryToken{}
+}
+
+//
+// accept consumes the next token if it is the punctuation text.
+//
+func (p *queryParser) accept(text string) bool {
+	if t := p.peek(); t.kind == 'p' && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(text string) error {
+	if !p.accept(text) {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("Expected '%s' at the end of the query", text)
+		}
+		return fmt.Errorf("Expected '%s' but found '%s'", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *queryParser) parsePipe() (queryFilter, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("|") {
+		right, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		left = pipeFilter(left, right)
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseComma() (queryFilter, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(",") {
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = commaFilter(left, right)
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseCompare() (queryFilter, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return compareFilter(op, left, right), nil
+		}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parsePostfix() (queryFilter, error) {
+	var step queryFilter
+	token := p.peek()
+
+	switch {
+	case p.accept("."):
+		step = identityFilter
+		if next := p.peek(); next.kind == 'i' || next.kind == 's' {
+			p.pos++
+			step = fieldFilter(next.value)
+		}
+	case p.accept("("):
+		inner, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		step = inner
+	case token.kind == 's':
+		p.pos++
+		step = literalFilter(token.value)
+	case token.kind == 'n':
+		p.pos++
+		step = literalFilter(json.Number(token.value))
+	case token.kind == 'i':
+		p.pos++
+		f, err := p.parseFunction(token.value)
+		if err != nil {
+			return nil, err
+		}
+		step = f
+	case token.kind == 0:
+		return nil, fmt.Errorf("Unexpected end of query")
+	default:
+		return nil, fmt.Errorf("Unexpected '%s' in query", token.text)
+	}
+
+	//
+	// Each suffix is a step applied to every output of the steps before it, so that a ? only
+	// suppresses errors from the step it follows.
+	//
+	var filter queryFilter = identityFilter
+	for {
+		if p.accept("?") {
+			step = optionalFilter(step)
+			continue
+		}
+
+		var next queryFilter
+		if p.accept(".") {
+			name := p.peek()
+			if name.kind != 'i' && name.kind != 's' {
+				return nil, fmt.Errorf("Expected a field name after '.'")
+			}
+			p.pos++
+			next = fieldFilter(name.value)
+		} else if p.accept("[") {
+			f, err := p.parseBrackets()
+			if err != nil {
+				return nil, err
+			}
+			next = f
+		} else {
+			return pipeFilter(filter, step), nil
+		}
+
+		filter = pipeFilter(filter, step)
+		step = next
+	}
+}
+
+//
+// parseBrackets handles everything after a '[', that is [], [n], ["key"] and [from:to].
+//
+func (p *queryParser) parseBrackets() (queryFilter, error) {
+	if p.accept("]") {
+		return iterateFilter, nil
+	}
+
+	if token := p.peek(); token.kind == 's' {
+		p.pos++
+		return fieldFilter(token.value), p.expect("]")
+	}
+
+	var from, to *int
+	number := func() (*int, error) {
+		token := p.peek()
+		if token.kind != 'n' {
+			return nil, nil
+		}
+		p.pos++
+		n, err := strconv.Atoi(token.value)
+		if err != nil {
+			return nil, fmt.Errorf("Bad array index '%s'", token.value)
+		}
+		return &n, nil
+	}
+
+	from, err := number()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept(":") {
+		if from == nil {
+			return nil, fmt.Errorf("Expected an index, a key or ']' after '['")
+		}
+		return indexFilter(*from), p.expect("]")
+	}
+
+	to, err = number()
+	if err != nil {
+		return nil, err
+	}
+	return sliceFilter(from, to), p.expect("]")
+}
+
+func (p *queryParser) parseFunction(name string) (queryFilter, error) {
+	switch name {
+	case "true":
+		return literalFilter(true), nil
+	case "false":
+		return literalFilter(false), nil
+	case "null":
+		return literalFilter(nil), nil
+	case "select", "map":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		arg, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if name == "select" {
+			return selectFilter(arg), nil
+		}
+		return pipeFilter(iterateFilter, arg).collect(), nil
+	}
+
+	if f, ok := queryFunctions[name]; ok {
+		return simpleFilter(f), nil
+	}
+	return nil, fmt.Errorf("Unknown function '%s'", name)
+}
+
+//
+// queryFunctions are the functions taking no arguments, each maps one input to one output.
+//
+var queryFunctions = map[string]func(interface{}) (interface{}, error){
+	"length": queryLength,
+	"keys":   queryKeys,
+	"type":   queryType,
+	"not": func(v interface{}) (interface{}, error) {
+		return !truthy(v), nil
+	},
+	"first": func(v interface{}) (interface{}, error) {
+		return indexValue(v, 0)
+	},
+	"last": func(v interface{}) (interface{}, error) {
+		return indexValue(v, -1)
+	},
+	"sort": querySort,
+}
+
+func identityFilter(input interface{}) ([]interface{}, error) {
+	return []interface{}{input}, nil
+}
+
+func literalFilter(value interface{}) queryFilter {
+	return func(interface{}) ([]interface{}, error) {
+		return []interface{}{value}, nil
+	}
+}
+
+func simpleFilter(f func(interface{}) (interface{}, error)) queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		value, err := f(input)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+}
+
+//
+// each applies f to every output of the filter, gathering the results.
+//
+func (filter queryFilter) each(f func(interface{}) ([]interface{}, error)) queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		values, err := filter(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var results []interface{}
+		for _, v := range values {
+			out, err := f(v)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, out...)
+		}
+		return results, nil
+	}
+}
+
+//
+// collect gathers every output of the filter into a single array.
+//
+func (filter queryFilter) collect() queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		values, err := filter(input)
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			values = []interface{}{}
+		}
+		return []interface{}{values}, nil
+	}
+}
+
+func pipeFilter(left, right queryFilter) queryFilter {
+	return left.each(right)
+}
+
+func commaFilter(left, right queryFilter) queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		a, err := left(input)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(input)
+		if err != nil {
+			return nil, err
+		}
+		return append(a, b...), nil
+	}
+}
+
+func optionalFilter(filter queryFilter) queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		values, err := filter(input)
+		if err != nil {
+			return nil, nil
+		}
+		return values, nil
+	}
+}
+
+func fieldFilter(key string) queryFilter {
+	return func(v interface{}) ([]interface{}, error) {
+		switch obj := v.(type) {
+		case nil:
+			return []interface{}{nil}, nil
+		case map[string]interface{}:
+			return []interface{}{obj[key]}, nil
+		}
+		return nil, fmt.Errorf("Can't look up '%s' in %s", key, typeName(v))
+	}
+}
+
+func indexFilter(index int) queryFilter {
+	return func(v interface{}) ([]interface{}, error) {
+		value, err := indexValue(v, index)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+}
+
+//
+// indexValue returns the element at index, negative indexes count from the end and anything out
+// of range is null.
+//
+func indexValue(v interface{}, index int) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Can't index %s with [%d]", typeName(v), index)
+	}
+	if index < 0 {
+		index += len(arr)
+	}
+	if index < 0 || index >= len(arr) {
+		return nil, nil
+	}
+	return arr[index], nil
+}
+
+func sliceFilter(from, to *int) queryFilter {
+	return func(v interface{}) ([]interface{}, error) {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Can't slice %s", typeName(v))
+		}
+
+		clamp := func(i *int, def int) int {
+			if i == nil {
+				return def
+			}
+			n := *i
+			if n < 0 {
+				n += len(arr)
+			}
+			if n < 0 {
+				return 0
+			}
+			if n > len(arr) {
+				return len(arr)
+			}
+			return n
+		}
+
+		start, end := clamp(from, 0), clamp(to, len(arr))
+		if start > end {
+			start = end
+		}
+		return []interface{}{arr[start:end]}, nil
+	}
+}
+
+//
+// iterateFilter outputs every element of an array, or every value of an object in key order.
+//
+func iterateFilter(v interface{}) ([]interface{}, error) {
+	switch c := v.(type) {
+	case []interface{}:
+		return c, nil
+	case map[string]interface{}:
+		keys, _ := queryKeys(c)
+		var values []interface{}
+		for _, k := range keys.([]interface{}) {
+			values = append(values, c[k.(string)])
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("Can't iterate over %s", typeName(v))
+}
+
+func selectFilter(cond queryFilter) queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		values, err := cond(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var results []interface{}
+		for _, v := range values {
+			if truthy(v) {
+				results = append(results, input)
+			}
+		}
+		return results, nil
+	}
+}
+
+func compareFilter(op string, left, right queryFilter) queryFilter {
+	return func(input interface{}) ([]interface{}, error) {
+		a, err := left(input)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(input)
+		if err != nil {
+			return nil, err
+		}
+
+		var results []interface{}
+		for _, x := range a {
+			for _, y := range b {
+				result, err := compareValues(op, x, y)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, result)
+			}
+		}
+		return results, nil
+	}
+}
+
+func compareValues(op string, x, y interface{}) (bool, error) {
+	if xn, ok := toNumber(x); ok {
+		if yn, ok := toNumber(y); ok {
+			x, y = xn, yn
+		}
+	}
+
+	switch op {
+	case "==":
+		return reflect.DeepEqual(x, y), nil
+	case "!=":
+		return !reflect.DeepEqual(x, y), nil
+	}
+
+	var cmp int
+	switch xv := x.(type) {
+	case float64:
+		yv, ok := y.(float64)
+		if !ok {
+			return false, fmt.Errorf("Can't compare %s with %s", typeName(x), typeName(y))
+		}
+		if xv < yv {
+			cmp = -1
+		} else if xv > yv {
+			cmp = 1
+		}
+	case string:
+		yv, ok := y.(string)
+		if !ok {
+			return false, fmt.Errorf("Can't compare %s with %s", typeName(x), typeName(y))
+		}
+		cmp = strings.Compare(xv, yv)
+	default:
+		return false, fmt.Errorf("Can't compare %s with %s", typeName(x), typeName(y))
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func queryType(v interface{}) (interface{}, error) {
+	return typeName(v), nil
+}
+
+func queryLength(v interface{}) (interface{}, error) {
+	switch c := v.(type) {
+	case nil:
+		return json.Number("0"), nil
+	case string:
+		return json.Number(strconv.Itoa(utf8.RuneCountInString(c))), nil
+	case []interface{}:
+		return json.Number(strconv.Itoa(len(c))), nil
+	case map[string]interface{}:
+		return json.Number(strconv.Itoa(len(c))), nil
+	}
+	return nil, fmt.Errorf("%s has no length", typeName(v))
+}
+
+func queryKeys(v interface{}) (interface{}, error) {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		result := make([]interface{}, len(keys))
+		for i, k := range keys {
+			result[i] = k
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(c))
+		for i := range c {
+			result[i] = json.Number(strconv.Itoa(i))
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%s has no keys", typeName(v))
+}
+
+func querySort(v interface{}) (interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Can't sort %s", typeName(v))
+	}
+
+	sorted := append([]interface{}{}, arr...)
+	var err error
+	sort.SliceStable(sorted, func(a, b int) bool {
+		less, e := compareValues("<", sorted[a], sorted[b])
+		if e != nil {
+			err = e
+		}
+		return less
+	})
+	return sorted, err
+}
+
+//
+// printQueryResults shows each result of a query as highlighted JSON.
+//
+func printQueryResults(term console, results []interface{}) {
+	for _, result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			term.printf("%v\n", err)
+			failures++
+			continue
+		}
+		renderJSON(term, data)
+		term.writeString("\n")
+	}
+}
+
+//
+// printQuery runs query against a response body, in place of showing the whole body.
+//
+func printQuery(term console, body []byte, query string) {
+	term.writeString("\n<<  ")
+	term.underscore()
+	term.printf("Query: %s\n", query)
+	term.reset()
+
+	results, err := runQuery(body, query)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+	printQueryResults(term, results)
+}
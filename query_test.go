@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const queryDocument = `{
+	"total": 3,
+	"items": [
+		{"id": 12345678901234567, "name": "alpha", "tags": ["a", "b"]},
+		{"id": 2, "name": "beta", "tags": []},
+		{"id": 3, "name": "gamma", "active": true}
+	],
+	"content-type": "json"
+}`
+
+func TestRunQuery(t *testing.T) {
+	expected := map[string]string{
+		".":                                  queryJSON(t, queryDocument),
+		".total":                             "3",
+		".items[0].id":                       "12345678901234567",
+		".items[].name":                      `"alpha","beta","gamma"`,
+		".items[-1].name":                    `"gamma"`,
+		".items[1:] | map(.id)":              "[2,3]",
+		".items | length":                    "3",
+		`."content-type"`:                    `"json"`,
+		`.["content-type"]`:                  `"json"`,
+		".missing":                           "null",
+		".items[] | select(.id > 2) | .name": `"alpha","gamma"`,
+		".items[] | select(.name == 'beta')": `{"id":2,"name":"beta","tags":[]}`,
+		".items[] | select(.active) | .id":   "3",
+		".items | map(.name)":                `["alpha","beta","gamma"]`,
+		".items[0] | keys":                   `["id","name","tags"]`,
+		".items[0].tags | first, last":       `"a","b"`,
+		".total, .items[2].name":             `3,"gamma"`,
+		"(.items | length) == .total":        "true",
+		".items[].tags[]?":                   `"a","b"`,
+		".items | map(.id) | sort":           "[2,3,12345678901234567]",
+		".items[1].tags | type":              `"array"`,
+	}
+
+	for query, output := range expected {
+		results, err := runQuery([]byte(queryDocument), query)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", query, err)
+		}
+
+		var encoded []string
+		for _, r := range results {
+			data, _ := json.Marshal(r)
+			encoded = append(encoded, string(data))
+		}
+		if strings.Join(encoded, ",") != output {
+			t.Fatalf("Expected %v for %v, found %v", output, query, strings.Join(encoded, ","))
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, query := range []string{"", ".[", ".items[", "items", ".a |", "select(.a", ".a = 1", "unknown", ".total[0]", ".total.x", ".items < 1"} {
+		if _, err := runQuery([]byte(queryDocument), query); err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", query)
+		}
+	}
+
+	if _, err := runQuery([]byte("<html>"), "."); err == nil {
+		t.Fatalf("Expected a non-nil error value for a non-JSON body!")
+	}
+}
+
+func TestSplitQuery(t *testing.T) {
+	tokens, query := splitQuery([]string{"/users", "Accept:application/json", "|", ".[0]", "|", "keys"})
+	if len(tokens) != 2 || query != ".[0] | keys" {
+		t.Fatalf("Expected 2 tokens and a query, found %v and %v", tokens, query)
+	}
+
+	tokens, query = splitQuery([]string{"/users", "|.[0].email"})
+	if len(tokens) != 1 || query != ".[0].email" {
+		t.Fatalf("Expected 1 token and a query, found %v and %v", tokens, query)
+	}
+
+	spec, err := parseRequestTokens("GET", []string{"/users", "|", ".[0].email"})
+	if err != nil || spec.url != "/users" || spec.query != ".[0].email" {
+		t.Fatalf("Expected the query to be split from the request, found %+v (%v)", spec, err)
+	}
+
+	if _, err := parseRequestTokens("GET", []string{"/users", "|", ".["}); err == nil {
+		t.Fatalf("Expected a non-nil error value for a bad query!")
+	}
+
+	//
+	// A > within the query is a comparison rather than output to a file
+	//
+	spec, err = parseRequestTokens("GET", []string{"/users", "|", ".count", ">", "3"})
+	if err != nil || spec.query != ".count > 3" || len(spec.output) > 0 {
+		t.Fatalf("Expected a comparison in the query, found %+v (%v)", spec, err)
+	}
+
+	if _, err := parseRequestTokens("GET", []string{"/users", ">", "users.json", "|", ".count"}); err == nil {
+		t.Fatalf("Expected a non-nil error value combining output with a query!")
+	}
+}
+
+func queryJSON(t *testing.T, document string) string {
+	data, err := decodeJSON([]byte(document))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	encoded, _ := json.Marshal(data)
+	return string(encoded)
+}
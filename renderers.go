@@ -0,0 +1,459 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Binary bodies larger than this are truncated in the hex dump
+const maxHexDump = 4096
+
+//
+// renderer writes a response body to the console, returning an error if the body couldn't be
+// rendered in which case it is shown raw instead.
+//
+type renderer struct {
+	name    string
+	matches func(mediaType string) bool
+	render  func(term console, body []byte) error
+}
+
+//
+// Renderers are checked in order against the response's media type, the first match wins.
+//
+var renderers = []renderer{
+	{"html", func(t string) bool { return t == "text/html" || t == "application/xhtml+xml" }, renderHTML},
+	{"json", func(t string) bool { return t == "application/json" || strings.HasSuffix(t, "+json") }, renderJSON},
+	{"xml", func(t string) bool { return strings.HasSuffix(t, "/xml") || strings.HasSuffix(t, "+xml") }, renderXML},
+	{"form", func(t string) bool { return t == "application/x-www-form-urlencoded" }, renderForm},
+	{"binary", isBinaryType, renderHex},
+}
+
+func isBinaryType(mediaType string) bool {
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	switch mediaType {
+	case "application/octet-stream", "application/pdf", "application/zip", "application/gzip", "application/x-protobuf":
+		return true
+	}
+	return false
+}
+
+//
+// selectRenderer picks a renderer based on the Content-Type, falling back to sniffing the body.
+// nil is returned if the body should just be written as it is.
+//
+func selectRenderer(contentType string, body []byte) *renderer {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for i := range renderers {
+			if renderers[i].matches(mediaType) {
+				return &renderers[i]
+			}
+		}
+	}
+
+	//
+	// Plenty of servers send JSON as text/plain, or with no Content-Type at all
+	//
+	if json.Valid(body) {
+		return rendererNamed("json")
+	}
+
+	if bytes.IndexByte(body, 0) >= 0 || !utf8.Valid(body) {
+		return rendererNamed("binary")
+	}
+	return nil
+}
+
+func rendererNamed(name string) *renderer {
+	for i := range renderers {
+		if renderers[i].name == name {
+			return &renderers[i]
+		}
+	}
+	return nil
+}
+
+//
+// renderBody writes body using the renderer for its Content-Type, unless raw is set.
+//
+func renderBody(term console, contentType string, body []byte, raw bool) {
+	if !raw {
+		if r := selectRenderer(contentType, body); r != nil && r.render(term, body) == nil {
+			return
+		}
+	}
+	term.writeBytes(body)
+}
+
+func renderJSON(term console, body []byte) error {
+	formatted := new(bytes.Buffer)
+	err := json.Indent(formatted, body, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	highlightJSON(term, formatted.Bytes())
+	return nil
+}
+
+//
+// highlightJSON colours already valid JSON, keys and string values are told apart by whether
+// a ':' follows them.
+//
+func highlightJSON(term console, data []byte) {
+	for i := 0; i < len(data); {
+		start := i
+		switch c := data[i]; {
+		case c == '"':
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+			i++
+			if i < len(data) && data[i] == ':' {
+				term.foreground(cyan)
+			} else {
+				term.foreground(green)
+			}
+		case c == '-' || (c >= '0' && c <= '9'):
+			for i < len(data) && strings.IndexByte("0123456789+-.eE", data[i]) >= 0 {
+				i++
+			}
+			term.foreground(yellow)
+		case c == 't' || c == 'f' || c == 'n':
+			for i < len(data) && data[i] >= 'a' && data[i] <= 'z' {
+				i++
+			}
+			term.foreground(magenta)
+		default:
+			for i < len(data) && strings.IndexByte("\"-0123456789tfn", data[i]) < 0 {
+				i++
+			}
+			term.writeBytes(data[start:i])
+			continue
+		}
+
+		term.writeBytes(data[start:i])
+		term.reset()
+	}
+}
+
+//
+// renderXML pretty prints XML, elements containing only text are kept on a single line.
+//
+func renderXML(term console, body []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+
+	//
+	// RawToken keeps namespace prefixes as they were written, but doesn't check elements are
+	// balanced so that is done here.
+	//
+	var tokens []xml.Token
+	var open []xml.Name
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			open = append(open, t.Name)
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1] != t.Name {
+				return fmt.Errorf("unexpected </%s>", xmlName(t.Name))
+			}
+			open = open[:len(open)-1]
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	if len(open) > 0 {
+		return fmt.Errorf("<%s> isn't closed", xmlName(open[len(open)-1]))
+	}
+
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		indent := strings.Repeat("  ", depth)
+
+		switch token := tokens[i].(type) {
+		case xml.StartElement:
+			term.writeString(indent)
+			writeXMLStart(term, token)
+
+			if i+1 < len(tokens) {
+				if _, ok := tokens[i+1].(xml.EndElement); ok {
+					term.writeString("/>\n")
+					i++
+					continue
+				}
+			}
+			term.writeString(">")
+
+			if i+2 < len(tokens) {
+				text, isText := tokens[i+1].(xml.CharData)
+				end, isEnd := tokens[i+2].(xml.EndElement)
+				if isText && isEnd {
+					writeXMLText(term, bytes.TrimSpace(text))
+					writeXMLEnd(term, end)
+					i += 2
+					continue
+				}
+			}
+			term.writeString("\n")
+			depth++
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+			}
+			term.writeString(strings.Repeat("  ", depth))
+			writeXMLEnd(term, token)
+		case xml.CharData:
+			term.writeString(indent)
+			writeXMLText(term, bytes.TrimSpace(token))
+			term.writeString("\n")
+		case xml.Comment:
+			term.writeString(indent)
+			term.dim()
+			term.printf("<!--%s-->", token)
+			term.reset()
+			term.writeString("\n")
+		case xml.ProcInst:
+			term.writeString(indent)
+			term.foreground(magenta)
+			term.printf("<?%s %s?>", token.Target, token.Inst)
+			term.reset()
+			term.writeString("\n")
+		case xml.Directive:
+			term.writeString(indent)
+			term.foreground(magenta)
+			term.printf("<!%s>", token)
+			term.reset()
+			term.writeString("\n")
+		}
+	}
+	return nil
+}
+
+func xmlName(name xml.Name) string {
+	if len(name.Space) > 0 {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func writeXMLStart(term console, start xml.StartElement) {
+	term.writeString("<")
+	term.foreground(blue)
+	term.writeString(xmlName(start.Name))
+	term.reset()
+
+	for _, attr := range start.Attr {
+		term.writeString(" ")
+		term.foreground(cyan)
+		term.writeString(xmlName(attr.Name))
+		term.reset()
+		term.writeString("=")
+		term.foreground(green)
+		term.writeString("\"")
+		xml.EscapeText(&consoleWriter{term}, []byte(attr.Value))
+		term.writeString("\"")
+		term.reset()
+	}
+}
+
+func writeXMLEnd(term console, end xml.EndElement) {
+	term.writeString("</")
+	term.foreground(blue)
+	term.writeString(xmlName(end.Name))
+	term.reset()
+	term.writeString(">\n")
+}
+
+func writeXMLText(term console, text []byte) {
+	xml.EscapeText(&consoleWriter{term}, text)
+}
+
+//
+// consoleWriter adapts a console to an io.Writer.
+//
+type consoleWriter struct {
+	term console
+}
+
+func (w *consoleWriter) Write(p []byte) (int, error) {
+	w.term.writeBytes(p)
+	return len(p), nil
+}
+
+// Tags which start a new line when converting HTML to text
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "title": true, "tr": true, "ul": true,
+}
+
+//
+// renderHTML shows the readable text of a page, dropping tags, scripts and styles.
+//
+func renderHTML(term console, body []byte) error {
+	term.writeString(htmlToText(string(body)))
+	return nil
+}
+
+func htmlToText(page string) string {
+	var out strings.Builder
+	lineStart := true
+	text := func(s string) {
+		s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+		if len(s) == 0 {
+			return
+		}
+		if !lineStart {
+			out.WriteString(" ")
+		}
+		out.WriteString(s)
+		lineStart = false
+	}
+
+	for len(page) > 0 {
+		open := strings.IndexByte(page, '<')
+		if open < 0 {
+			text(page)
+			break
+		}
+		text(page[:open])
+		page = page[open:]
+
+		if strings.HasPrefix(page, "<!--") {
+			end := strings.Index(page, "-->")
+			if end < 0 {
+				break
+			}
+			page = page[end+3:]
+			continue
+		}
+
+		end := strings.IndexByte(page, '>')
+		if end < 0 {
+			break
+		}
+		closing := strings.HasPrefix(page[1:end], "/")
+		tag := strings.ToLower(strings.Trim(page[1:end], "/ "))
+		if i := strings.IndexAny(tag, " \t\r\n/"); i >= 0 {
+			tag = tag[:i]
+		}
+		page = page[end+1:]
+
+		if !closing && (tag == "script" || tag == "style") {
+			close := strings.Index(strings.ToLower(page), "</"+tag)
+			if close < 0 {
+				break
+			}
+			page = page[close:]
+			continue
+		}
+
+		if htmlBlockTags[tag] && !lineStart {
+			out.WriteString("\n")
+			lineStart = true
+		}
+		if tag == "li" && !closing {
+			out.WriteString(" -")
+			lineStart = false
+		}
+	}
+
+	result := strings.TrimSpace(out.String())
+	if len(result) == 0 {
+		return ""
+	}
+	return result + "\n"
+}
+
+//
+// renderForm shows form encoded fields as a table.
+//
+func renderForm(term console, body []byte) error {
+	values, err := url.ParseQuery(strings.TrimSpace(string(body)))
+	if err != nil {
+		return err
+	}
+
+	width := 0
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+		if len(k) > width {
+			width = len(k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range values[k] {
+			term.foreground(cyan)
+			term.printf(" %-*s", width, k)
+			term.reset()
+			term.printf(" | %s\n", v)
+		}
+	}
+	return nil
+}
+
+//
+// renderHex shows binary content as a hex dump, truncated if it is large.
+//
+func renderHex(term console, body []byte) error {
+	shown := body
+	if len(shown) > maxHexDump {
+		shown = shown[:maxHexDump]
+	}
+
+	term.writeString(hex.Dump(shown))
+	if len(shown) < len(body) {
+		term.dim()
+		term.printf("... %d more bytes\n", len(body)-len(shown))
+		term.reset()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelectRenderer(t *testing.T) {
+	expected := map[string]string{
+		"application/json; charset=utf-8":   "json",
+		"application/problem+json":          "json",
+		"text/xml":                          "xml",
+		"application/atom+xml":              "xml",
+		"text/html; charset=UTF-8":          "html",
+		"application/x-www-form-urlencoded": "form",
+		"image/png":                         "binary",
+	}
+
+	for contentType, name := range expected {
+		if r := selectRenderer(contentType, []byte("x")); r == nil || r.name != name {
+			t.Fatalf("Expected the %v renderer for %v, found %+v", name, contentType, r)
+		}
+	}
+
+	if r := selectRenderer("text/plain", []byte(`{"a": 1}`)); r == nil || r.name != "json" {
+		t.Fatalf("Expected JSON to be detected from the body, found %+v", r)
+	}
+	if r := selectRenderer("", []byte{0x89, 'P', 'N', 'G', 0}); r == nil || r.name != "binary" {
+		t.Fatalf("Expected binary to be detected from the body, found %+v", r)
+	}
+	if r := selectRenderer("text/plain", []byte("hello")); r != nil {
+		t.Fatalf("Expected plain text to be written raw, found %+v", r)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	expected := []struct {
+		contentType string
+		body        string
+		output      string
+	}{
+		{"application/json", `{"a":[1,true,"x:y"]}`, "{\n  \"a\": [\n    1,\n    true,\n    \"x:y\"\n  ]\n}"},
+		{"text/xml", `<?xml version="1.0"?><a id="1"><b>text</b><c/></a>`,
+			"<?xml version=\"1.0\"?>\n<a id=\"1\">\n  <b>text</b>\n  <c/>\n</a>\n"},
+		{"text/html", "<html><head><title>Hi</title><style>p {}</style></head><body><p>One &amp;\n two</p><ul><li>A</li></ul></body></html>",
+			"Hi\nOne & two\n - A\n"},
+		{"application/x-www-form-urlencoded", "name=Jo+Smith&id=7", " id   | 7\n name | Jo Smith\n"},
+		{"application/octet-stream", "\x00\x01AB", "00000000  00 01 41 42                                       |..AB|\n"},
+	}
+
+	for _, e := range expected {
+		capture := &captureConsole{}
+		renderBody(capture, e.contentType, []byte(e.body), false)
+		if capture.String() != e.output {
+			t.Fatalf("Expected %q for %v, found %q", e.output, e.contentType, capture.String())
+		}
+	}
+
+	capture := &captureConsole{}
+	renderBody(capture, "application/json", []byte(`{"a":1}`), true)
+	if capture.String() != `{"a":1}` {
+		t.Fatalf("Expected raw output, found %v", capture.String())
+	}
+
+	capture = &captureConsole{}
+	renderBody(capture, "text/xml", []byte("<a><b></a>"), false)
+	if !strings.HasPrefix(capture.String(), "<a><b></a>") {
+		t.Fatalf("Expected malformed XML to be written raw, found %v", capture.String())
+	}
+}
@@ -0,0 +1,517 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+type itemKind int
+
+const (
+	headerItem   itemKind = iota // Header:value
+	paramItem                    // param==value
+	dataItem                     // field=value
+	rawJSONItem                  // field:=rawjson
+	fileDataItem                 // field@file
+)
+
+// Given anywhere in a request's tokens, switches data items to a multipart/form-data body
+const multipartFlag = "--multipart"
+
+//
+// Separators are checked in this order when they occur at the same position within a token,
+// so that the longer separators win (':=' over ':', '==' over '=').
+//
+var itemSeparators = []struct {
+	sep  string
+	kind itemKind
+}{
+	{":=", rawJSONItem},
+	{"==", paramItem},
+	{"=", dataItem},
+	{":", headerItem},
+	{"@", fileDataItem},
+}
+
+//
+// requestItem is a single one-shot item from the command line, only applied to the request
+// it was specified on.
+//
+type requestItem struct {
+	kind  itemKind
+	key   string
+	value string
+}
+
+//
+// requestSpec holds everything parsed from a request command line, prior to it being merged with
+// the active configuration.
+//
+type requestSpec struct {
+	method   string
+	url      string
+	bodyFile string
+	items    []requestItem
+
+	// Optional query applied to the response, see compileQuery
+	query string
+
+	// Optional file the response is written to
+	output string
+
+	// Send data fields and files as multipart/form-data, rather than JSON
+	multipart bool
+
+	// A body typed on the command line, pasted or composed in an editor, see resolveBody
+	body     string
+	sentinel string
+	edit     bool
+}
+
+//
+// parseRequestItem parses a token such as 'Accept:text/plain' or 'count:=3'.  The earliest separator
+// in the token determines the kind of item.
+//
+func parseRequestItem(token string) (*requestItem, error) {
+	pos := -1
+	var item *requestItem
+
+	for _, s := range itemSeparators {
+		i := strings.Index(token, s.sep)
+		if i < 0 || (pos >= 0 && i >= pos) {
+			continue
+		}
+		pos = i
+		item = &requestItem{kind: s.kind, key: token[:i], value: token[i+len(s.sep):]}
+	}
+
+	if item == nil {
+		return nil, fmt.Errorf("'%s' isn't a valid request item", token)
+	}
+
+	if len(item.key) == 0 {
+		return nil, fmt.Errorf("'%s' is missing a name", token)
+	}
+
+	//
+	// Raw JSON containing variable references can only be validated once they've been substituted
+	//
+	if item.kind == rawJSONItem && !variablePattern.MatchString(item.value) && !json.Valid([]byte(item.value)) {
+		return nil, fmt.Errorf("'%s' doesn't contain valid JSON", token)
+	}
+
+	return item, nil
+}
+
+//
+// String gives the item back as it would be typed.
+//
+func (i requestItem) String() string {
+	for _, s := range itemSeparators {
+		if s.kind == i.kind {
+			return i.key + s.sep + i.value
+		}
+	}
+	return i.key
+}
+
+//
+// splitOutput separates a trailing '> file' (or '>file') from a command's tokens.
+//
+func splitOutput(tokens []string) ([]string, string) {
+	n := len(tokens)
+	if n > 1 && tokens[n-2] == ">" {
+		return tokens[:n-2], tokens[n-1]
+	}
+	if n > 0 && len(tokens[n-1]) > 1 && strings.HasPrefix(tokens[n-1], ">") {
+		return tokens[:n-1], tokens[n-1][1:]
+	}
+	return tokens, ""
+}
+
+//
+// parseRequestTokens builds a requestSpec from the supplied tokens, which should not include the
+// command itself.  The URL, if present, is the first token, anything after a | token is a query
+// to apply to the response and otherwise a final '> file' writes the response to a file.  A body may be
+// given inline ('{"a":1}'), pasted up to a sentinel line (<<EOF) or composed with --edit.
+//
+func parseRequestTokens(method string, tokens []string) (*requestSpec, error) {
+	spec := &requestSpec{method: method}
+
+	//
+	// The query is split off first, as it may contain a > of its own (such as '| .count > 3')
+	//
+	tokens, spec.query = splitQuery(tokens)
+	tokens, spec.output = splitOutput(tokens)
+	if len(spec.query) > 0 && len(spec.output) > 0 {
+		return nil, fmt.Errorf("A query can't be combined with > output")
+	}
+	if len(spec.query) > 0 {
+		if _, err := compileQuery(spec.query); err != nil {
+			return nil, err
+		}
+	}
+
+	first := true
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == multipartFlag {
+			spec.multipart = true
+			continue
+		}
+
+		if token == editFlag {
+			spec.edit = true
+			continue
+		}
+
+		if strings.HasPrefix(token, pastePrefix) || isInlineBody(token) {
+			if len(spec.body) > 0 || len(spec.sentinel) > 0 {
+				return nil, fmt.Errorf("Only one body may be supplied")
+			}
+
+			if isInlineBody(token) {
+				spec.body = token
+			} else if spec.sentinel = strings.TrimPrefix(token, pastePrefix); len(spec.sentinel) == 0 {
+				if i+1 == len(tokens) {
+					return nil, fmt.Errorf("%s must be followed by a line to end the body with", pastePrefix)
+				}
+				i++
+				spec.sentinel = tokens[i]
+			}
+			first = false
+			continue
+		}
+
+		//
+		// As with HTTPie the first positional token is always the URL, even when it looks like
+		// an item (users?page=2 or localhost:8080/x).
+		//
+		if first && !strings.HasPrefix(token, "@") {
+			spec.url = token
+			first = false
+			continue
+		}
+		first = false
+
+		if strings.HasPrefix(token, "@") {
+			if len(spec.bodyFile) > 0 {
+				return nil, fmt.Errorf("Only one @ data file may be supplied")
+			}
+			spec.bodyFile = strings.TrimPrefix(token, "@")
+			continue
+		}
+
+		item, err := parseRequestItem(token)
+		if err != nil {
+			return nil, err
+		}
+		spec.items = append(spec.items, *item)
+	}
+
+	return spec, nil
+}
+
+func (s *requestSpec) options() responseOptions {
+	return responseOptions{query: s.query, output: s.output}
+}
+
+//
+// hasBody reports whether this spec will produce a request body of its own.
+//
+func (s *requestSpec) hasBody() bool {
+	if len(s.bodyFile) > 0 || len(s.body) > 0 || len(s.sentinel) > 0 || s.edit {
+		return true
+	}
+	for _, item := range s.items {
+		if item.kind == dataItem || item.kind == rawJSONItem || item.kind == fileDataItem {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// jsonBody builds a JSON object out of any data items, or returns nil if there are none.
+//
+func (s *requestSpec) jsonBody() ([]byte, error) {
+	fields := make(map[string]interface{})
+
+	for _, item := range s.items {
+		switch item.kind {
+		case dataItem:
+			fields[item.key] = item.value
+		case rawJSONItem:
+			if !json.Valid([]byte(item.value)) {
+				return nil, fmt.Errorf("'%s' doesn't contain valid JSON", item.value)
+			}
+			fields[item.key] = json.RawMessage(item.value)
+		case fileDataItem:
+			data, err := ioutil.ReadFile(item.value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %v: %v", item.value, err)
+			}
+			fields[item.key] = string(data)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(fields)
+}
+
+//
+// build merges the spec with the configuration, producing a request ready to hand to doRequest.
+// If formParams is set, the configuration's params are sent as a form encoded body (unless
+// overridden by an explicit body) rather than as part of the query.
+//
+func (s *requestSpec) build(config *configuration, formParams bool) (*http.Request, error) {
+
+	//
+	// Variables are substituted before anything else, so {{name}} may appear in the root, URL, items and
+	// the configuration's headers and params.  Data files are always sent verbatim.
+	//
+	s, err := s.interpolated()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := interpolate(config.settings.Settings["root"])
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := interpolateMap(config.settings.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := interpolateMap(config.settings.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	reqURL, abs, err := buildURL(root, s.url)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't build URL: %v", err)
+	}
+
+	// Optional request body, may be either parameter or data based.
+	var body []byte
+	contentType := ""
+
+	query := reqURL.Query()
+
+	//
+	// If the user-supplied URL is absolute, don't attach the config's parameters/headers, as it may contain
+	// sensitive data.
+	//
+	if !abs {
+		if formParams {
+			form := url.Values{}
+			for k, v := range params {
+				form.Add(k, v)
+			}
+			if len(form) > 0 {
+				contentType = "application/x-www-form-urlencoded"
+				body = []byte(form.Encode())
+			}
+		} else {
+			for k, v := range params {
+				query.Add(k, v)
+			}
+		}
+	}
+
+	for _, item := range s.items {
+		if item.kind == paramItem {
+			query.Add(item.key, item.value)
+		}
+	}
+	reqURL.RawQuery = query.Encode()
+
+	var data []byte
+	if !s.multipart {
+		data, err = s.jsonBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if (data != nil || s.multipart) && len(s.bodyFile) > 0 {
+		return nil, fmt.Errorf("Data fields can't be combined with an @ data file")
+	}
+
+	if len(s.body) > 0 && (data != nil || s.multipart || len(s.bodyFile) > 0) {
+		return nil, fmt.Errorf("An inline body can't be combined with data fields or an @ data file")
+	}
+
+	//
+	// A multipart body replaces any form encoded params, which become fields of their own
+	//
+	var form *multipartBody
+	if s.multipart {
+		fields := map[string]string{}
+		if formParams && !abs {
+			fields = params
+		}
+
+		form, err = newMultipartBody(s.items, fields)
+		if err != nil {
+			return nil, err
+		}
+		body = nil
+		contentType = form.contentType
+	}
+
+	if data != nil {
+		body = data
+		contentType = "application/json"
+	}
+
+	if len(s.body) > 0 {
+		body = []byte(s.body)
+		contentType = inlineContentType(s.body)
+	}
+
+	// Data files are streamed from disk rather than read up front, see attachBodyFile
+	if len(s.bodyFile) > 0 {
+		body = nil
+		contentType = contentTypes[strings.TrimPrefix(filepath.Ext(s.bodyFile), ".")]
+	}
+
+	var request *http.Request
+	if body != nil {
+		request, err = http.NewRequest(s.method, reqURL.String(), bytes.NewReader(body))
+	} else {
+		request, err = http.NewRequest(s.method, reqURL.String(), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't build request: %v", err)
+	}
+
+	if len(s.bodyFile) > 0 {
+		err = attachBodyFile(request, s.bodyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if form != nil {
+		err = form.attach(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if boolSettingValue(config.settings.Settings, "chunked", false) && request.Body != nil && request.Body != http.NoBody {
+		request.ContentLength = -1
+		request.TransferEncoding = []string{"chunked"}
+	}
+
+	if !abs {
+		for k, v := range headers {
+			request.Header[k] = []string{v}
+		}
+	}
+
+	// If no custom Content-Type has been specified, use what we've discovered
+	if len(contentType) > 0 && len(headers["Content-Type"]) == 0 {
+		request.Header["Content-Type"] = []string{contentType}
+	}
+
+	//
+	// Header items are applied last so they override the configuration, an empty value removes the
+	// header from this request entirely.
+	//
+	for _, item := range s.items {
+		if item.kind == headerItem {
+			setHeader(request.Header, item.key, item.value)
+		}
+	}
+
+	return request, nil
+}
+
+//
+// interpolated returns a copy of the spec with variables substituted in the URL and items.
+//
+func (s *requestSpec) interpolated() (*requestSpec, error) {
+	var err error
+	spec := &requestSpec{method: s.method, bodyFile: s.bodyFile, query: s.query, output: s.output, multipart: s.multipart}
+
+	spec.url, err = interpolate(s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	spec.body, err = interpolate(s.body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range s.items {
+		item.key, err = interpolate(item.key)
+		if err != nil {
+			return nil, err
+		}
+		item.value, err = interpolate(item.value)
+		if err != nil {
+			return nil, err
+		}
+		spec.items = append(spec.items, item)
+	}
+
+	return spec, nil
+}
+
+func interpolateMap(m map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		value, err := interpolate(v)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = value
+	}
+	return result, nil
+}
+
+//
+// setHeader replaces any existing values for key, regardless of case.  An empty value removes the header.
+//
+func setHeader(h http.Header, key, value string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+
+	if len(value) > 0 {
+		h[key] = []string{value}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseRequestItems(t *testing.T) {
+	cases := []struct {
+		token string
+		kind  itemKind
+		key   string
+		value string
+	}{
+		{"Accept:text/plain", headerItem, "Accept", "text/plain"},
+		{"Authorization:Bearer abc==", headerItem, "Authorization", "Bearer abc=="},
+		{"page==2", paramItem, "page", "2"},
+		{"name=John Smith", dataItem, "name", "John Smith"},
+		{"count:=3", rawJSONItem, "count", "3"},
+		{"tags:=[\"a\",\"b\"]", rawJSONItem, "tags", "[\"a\",\"b\"]"},
+		{"bio@/tmp/bio.txt", fileDataItem, "bio", "/tmp/bio.txt"},
+		{"X-Empty:", headerItem, "X-Empty", ""},
+	}
+
+	for _, c := range cases {
+		item, err := parseRequestItem(c.token)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %v: %v", c.token, err)
+		}
+		if item.kind != c.kind || item.key != c.key || item.value != c.value {
+			t.Fatalf("Bad parse of %v, found %+v", c.token, item)
+		}
+	}
+}
+
+func TestParseInvalidItems(t *testing.T) {
+	for _, token := range []string{"nothing", "=value", "count:=notjson"} {
+		_, err := parseRequestItem(token)
+		if err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", token)
+		}
+	}
+}
+
+func TestBuildWithItems(t *testing.T) {
+	config := defaultConfig()
+	config.settings.Settings["root"] = "https://example.com"
+	config.settings.Params["global"] = "yes"
+
+	spec, err := parseRequestTokens("POST", []string{"/users", "X-Test:one", "Accept:", "page==2", "name=acro", "age:=5"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request, err := spec.build(config, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if request.URL.String() != "https://example.com/users?page=2" {
+		t.Fatalf("Bad URL: %v", request.URL)
+	}
+
+	if request.Header.Get("X-Test") != "one" {
+		t.Fatalf("Missing X-Test header: %v", request.Header)
+	}
+
+	if len(request.Header.Get("Accept")) > 0 {
+		t.Fatalf("Accept should have been removed: %v", request.Header)
+	}
+
+	if request.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Bad Content-Type: %v", request.Header.Get("Content-Type"))
+	}
+
+	data, _ := ioutil.ReadAll(request.Body)
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Body isn't valid JSON: %s", data)
+	}
+	if fields["name"] != "acro" || fields["age"] != float64(5) {
+		t.Fatalf("Bad body: %s", data)
+	}
+
+	if _, ok := config.settings.Headers["X-Test"]; ok {
+		t.Fatalf("Request items shouldn't modify the configuration")
+	}
+}
+
+func TestFirstTokenURL(t *testing.T) {
+	for _, url := range []string{"users?page=2", "localhost:8080/x", "page==2"} {
+		spec, err := parseRequestTokens("GET", []string{url, "X-Id:1"})
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", url, err)
+		}
+
+		if spec.url != url || len(spec.items) != 1 || spec.items[0].key != "X-Id" {
+			t.Fatalf("Expected %s to be the URL, found %+v", url, spec)
+		}
+	}
+}
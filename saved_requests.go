@@ -0,0 +1,755 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Collections are kept in this directory within the config root
+const collectionsDir = "requests"
+
+// The collection used when the 'collection' setting isn't set
+const defaultCollection = "default"
+
+//
+// The most recent request command, as it was typed, so it can be saved with save-request.
+//
+var lastSpec *requestSpec
+
+//
+// rememberSpec keeps a copy of spec as the last request command.  Its body has already been read,
+// so it's kept as an ordinary body rather than being pasted or edited again.
+//
+func rememberSpec(spec *requestSpec) {
+	remembered := *spec
+	remembered.sentinel = ""
+	remembered.edit = false
+	lastSpec = &remembered
+}
+
+//
+// savedRequest is a request saved by name, as it was typed, so variables are substituted and the
+// configuration's headers and params applied each time it is run.
+//
+type savedRequest struct {
+	Name      string   `yaml:"name"`
+	Folder    string   `yaml:"folder,omitempty"`
+	Method    string   `yaml:"method"`
+	URL       string   `yaml:"url,omitempty"`
+	Items     []string `yaml:"items,omitempty"`
+	Body      string   `yaml:"body,omitempty"`
+	BodyFile  string   `yaml:"bodyFile,omitempty"`
+	Multipart bool     `yaml:"multipart,omitempty"`
+	Query     string   `yaml:"query,omitempty"`
+	Output    string   `yaml:"output,omitempty"`
+}
+
+func newSavedRequest(path string, spec *requestSpec) *savedRequest {
+	r := &savedRequest{Method: spec.method, URL: spec.url, Body: spec.body, BodyFile: spec.bodyFile,
+		Multipart: spec.multipart, Query: spec.query, Output: spec.output}
+	r.setPath(path)
+
+	for _, item := range spec.items {
+		r.Items = append(r.Items, item.String())
+	}
+	return r
+}
+
+//
+// path is the request's name within its collection, such as 'auth/login'.
+//
+func (r *savedRequest) path() string {
+	if len(r.Folder) > 0 {
+		return r.Folder + "/" + r.Name
+	}
+	return r.Name
+}
+
+func (r *savedRequest) setPath(path string) {
+	r.Folder, r.Name = "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		r.Folder, r.Name = path[:i], path[i+1:]
+	}
+}
+
+//
+// spec turns the saved request back into a requestSpec, ready to be built.
+//
+func (r *savedRequest) spec() (*requestSpec, error) {
+	if len(r.Method) == 0 {
+		return nil, fmt.Errorf("%s has no method", r.path())
+	}
+
+	spec := &requestSpec{method: strings.ToUpper(r.Method), url: r.URL, body: r.Body, bodyFile: r.BodyFile,
+		multipart: r.Multipart, query: r.Query, output: r.Output}
+
+	for _, token := range r.Items {
+		item, err := parseRequestItem(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", r.path(), err)
+		}
+		spec.items = append(spec.items, *item)
+	}
+	return spec, nil
+}
+
+//
+// collection is a file of saved requests, which may be grouped into folders.
+//
+type collection struct {
+	name     string
+	path     string
+	Requests []*savedRequest `yaml:"requests"`
+}
+
+//
+// activeCollection is the collection named by the 'collection' setting.
+//
+func activeCollection(config *configuration) string {
+	if name := config.settings.Settings["collection"]; len(name) > 0 {
+		return name
+	}
+	return defaultCollection
+}
+
+//
+// splitRequestName separates an optional 'collection:' prefix from a request or folder name.
+//
+func splitRequestName(config *configuration, name string) (string, string) {
+	if i := strings.Index(name, ":"); i > 0 {
+		return name[:i], strings.Trim(name[i+1:], "/")
+	}
+	return activeCollection(config), strings.Trim(name, "/")
+}
+
+func validRequestPath(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) == 0 || strings.ContainsAny(segment, ": \t") {
+			return fmt.Errorf("'%s' isn't a valid name, use letters and / to separate folders", path)
+		}
+	}
+	return nil
+}
+
+func collectionPath(name string) (string, error) {
+	if len(configRoot) == 0 {
+		return "", fmt.Errorf("Cannot determine collection location because config root is not known.")
+	}
+	if len(name) == 0 || strings.ContainsAny(name, "/\\") {
+		return "", fmt.Errorf("'%s' isn't a valid collection name", name)
+	}
+	return filepath.Join(configRoot, collectionsDir, name+".yml"), nil
+}
+
+//
+// loadCollection reads the named collection, a collection that doesn't exist yet is empty.
+//
+func loadCollection(name string) (*collection, error) {
+	path, err := collectionPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &collection{name: name, path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read collection %s: %v", name, err)
+	}
+	return c, nil
+}
+
+func (c *collection) write() error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(filepath.Dir(c.path), 0700)
+	return ioutil.WriteFile(c.path, data, 0600)
+}
+
+// listCollections returns the names of all collections found in the config root.
+func listCollections() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(configRoot, collectionsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".yml" {
+			names = append(names, strings.TrimSuffix(file.Name(), ".yml"))
+		}
+	}
+	return names, nil
+}
+
+func (c *collection) find(path string) *savedRequest {
+	for _, r := range c.Requests {
+		if r.path() == path {
+			return r
+		}
+	}
+	return nil
+}
+
+//
+// put adds r, replacing any request with the same path in place so the order is kept.
+//
+func (c *collection) put(r *savedRequest) {
+	for i, existing := range c.Requests {
+		if existing.path() == r.path() {
+			c.Requests[i] = r
+			return
+		}
+	}
+	c.Requests = append(c.Requests, r)
+}
+
+//
+// selectRequests returns the request with the given path or, failing that, every request within
+// the folder with that path in the order they were saved.  An empty path selects everything.
+//
+func (c *collection) selectRequests(path string) []*savedRequest {
+	if r := c.find(path); r != nil {
+		return []*savedRequest{r}
+	}
+
+	var selected []*savedRequest
+	for _, r := range c.Requests {
+		if len(path) == 0 || r.Folder == path || strings.HasPrefix(r.Folder, path+"/") {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
+
+//
+// remove deletes the selected requests, returning how many there were.  Unlike selectRequests an
+// empty path selects nothing, so a whole collection can't be removed by accident.
+//
+func (c *collection) remove(path string) int {
+	selected := c.selectRequests(path)
+	if len(path) == 0 {
+		selected = nil
+	}
+
+	var kept []*savedRequest
+	for _, r := range c.Requests {
+		removed := false
+		for _, s := range selected {
+			removed = removed || r == s
+		}
+		if !removed {
+			kept = append(kept, r)
+		}
+	}
+	c.Requests = kept
+	return len(selected)
+}
+
+//
+// formParamsFor determines if the configuration's params are sent as a body for method, as they
+// are for post and put.
+//
+func formParamsFor(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "DELETE", "OPTIONS":
+		return false
+	}
+	return true
+}
+
+//
+// sendSpec builds and sends a request, recording it as the last request command.
+//
+func sendSpec(term console, config *configuration, spec *requestSpec) {
+	rememberSpec(spec)
+
+	request, err := spec.build(config, formParamsFor(spec.method))
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+	rememberBody(spec)
+
+	err = doRequest(term, request, spec.options())
+	if err != nil {
+		term.printf("Error performing %s: %v\n", spec.method, err)
+		failures++
+	}
+}
+
+//
+// buildSavedRequest builds the named request with the configuration applied, without sending it.
+//
+func buildSavedRequest(config *configuration, name string) (*http.Request, error) {
+	collectionName, path := splitRequestName(config, name)
+	coll, err := loadCollection(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	r := coll.find(path)
+	if r == nil {
+		return nil, fmt.Errorf("There's no saved request called %s", name)
+	}
+
+	spec, err := r.spec()
+	if err != nil {
+		return nil, err
+	}
+	return spec.build(config, formParamsFor(spec.method))
+}
+
+//
+// savedRequestNames lists the requests and folders of the active collection for completion.
+//
+func savedRequestNames(config *configuration) []string {
+	c, err := loadCollection(activeCollection(config))
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range c.Requests {
+		for _, name := range []string{r.Folder, r.path()} {
+			if len(name) > 0 && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+type saveRequestCommand struct{}
+
+func (c *saveRequestCommand) description() string {
+	return "Saves the last request command, or the one given, under a name"
+}
+
+func (c *saveRequestCommand) usage() string {
+	return "[collection:][folder/]<name> [<METHOD> <url> [items...]]"
+}
+
+func (c *saveRequestCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) < 2 {
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	collectionName, path := splitRequestName(config, tokens[1])
+	if err := validRequestPath(path); err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	spec := lastSpec
+	if len(tokens) > 2 {
+		var err error
+		spec, err = parseRequestTokens(strings.ToUpper(tokens[2]), tokens[3:])
+		if err == nil {
+			err = spec.resolveBody(term)
+		}
+		if err != nil {
+			term.printf("%v\n", err)
+			failures++
+			return
+		}
+	}
+
+	if spec == nil {
+		term.printf("No request has been made yet, give one to save such as '%s %s get /users'\n", tokens[0], tokens[1])
+		failures++
+		return
+	}
+
+	saveSpec(term, collectionName, path, spec)
+}
+
+//
+// saveSpec saves the spec as the request at path within the named collection, reporting the outcome.
+//
+func saveSpec(term console, collectionName, path string, spec *requestSpec) {
+	coll, err := loadCollection(collectionName)
+	if err == nil {
+		coll.put(newSavedRequest(path, spec))
+		err = coll.write()
+	}
+	if err != nil {
+		term.printf("Couldn't save %s: %v\n", path, err)
+		failures++
+		return
+	}
+	term.printf("Saved %s to collection %s\n", path, collectionName)
+}
+
+func (c *saveRequestCommand) complete(tokens []string) []string {
+	switch len(tokens) {
+	case 2:
+		return savedRequestNames(config)
+	case 3:
+		return []string{"get", "head", "delete", "options", "post", "put", "patch"}
+	}
+	return nil
+}
+
+//
+// runRequestsCommand runs saved requests, a folder runs everything within it in order.
+//
+type runRequestsCommand struct{}
+
+func (c *runRequestsCommand) description() string {
+	return "Runs saved requests or folders of them in order, stopping at the first failure"
+}
+
+func (c *runRequestsCommand) usage() string {
+	return "[collection:]<name|folder> ..."
+}
+
+func (c *runRequestsCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) < 2 {
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	//
+	// Everything is looked up before anything is sent, so a typo doesn't leave a sequence half run
+	//
+	var selected []*savedRequest
+	for _, name := range tokens[1:] {
+		collectionName, path := splitRequestName(config, name)
+		coll, err := loadCollection(collectionName)
+		if err != nil {
+			term.printf("%v\n", err)
+			failures++
+			return
+		}
+
+		requests := coll.selectRequests(path)
+		if len(requests) == 0 {
+			term.printf("There's no saved request or folder called %s\n", name)
+			failures++
+			return
+		}
+		selected = append(selected, requests...)
+	}
+
+	for _, r := range selected {
+		before := failures
+		if len(selected) > 1 {
+			term.bright()
+			term.printf("\n# %s\n", r.path())
+			term.reset()
+		}
+
+		spec, err := r.spec()
+		if err != nil {
+			term.printf("%v\n", err)
+			failures++
+		} else {
+			sendSpec(term, config, spec)
+		}
+
+		if failures > before && len(selected) > 1 {
+			term.printf("Stopping, %s failed\n", r.path())
+			return
+		}
+	}
+}
+
+func (c *runRequestsCommand) complete(tokens []string) []string {
+	return savedRequestNames(config)
+}
+
+//
+// requestsCommand lists and maintains saved requests.
+//
+type requestsCommand struct{}
+
+func (c *requestsCommand) description() string {
+	return "Lists, shows, edits, moves and removes saved requests"
+}
+
+func (c *requestsCommand) usage() string {
+	return "[list [collection]] | [show <name>] | [edit <name>] | [move <name> <new name>] | [remove <name|folder>] | [collections]"
+}
+
+func (c *requestsCommand) exec(tokens []string, term console, config *configuration) {
+	option := "list"
+	if len(tokens) > 1 {
+		option = tokens[1]
+	}
+
+	switch option {
+	case "list":
+		name := activeCollection(config)
+		if len(tokens) > 2 {
+			name = strings.TrimSuffix(tokens[2], ":")
+		}
+		c.list(term, name)
+	case "collections":
+		names, err := listCollections()
+		if err != nil {
+			term.printf("Couldn't list collections: %v\n", err)
+			failures++
+			return
+		}
+		for _, name := range names {
+			marker := " "
+			if name == activeCollection(config) {
+				marker = "*"
+			}
+			term.printf("%s %s\n", marker, name)
+		}
+	case "show", "edit", "remove":
+		if len(tokens) < 3 {
+			term.printf("Please supply a request name, such as '%s %s login'\n", tokens[0], option)
+			failures++
+			return
+		}
+		collectionName, path := splitRequestName(config, tokens[2])
+		coll, err := loadCollection(collectionName)
+		if err != nil {
+			term.printf("%v\n", err)
+			failures++
+			return
+		}
+
+		switch option {
+		case "show":
+			c.show(term, coll, path)
+		case "edit":
+			c.edit(term, coll, path)
+		case "remove":
+			n := coll.remove(path)
+			if n == 0 {
+				term.printf("There's no saved request or folder called %s\n", tokens[2])
+				failures++
+				return
+			}
+			if err := coll.write(); err != nil {
+				term.printf("Couldn't save collection %s: %v\n", coll.name, err)
+				failures++
+				return
+			}
+			term.printf("Removed %d request(s)\n", n)
+		}
+	case "move":
+		if len(tokens) < 4 {
+			term.printf("Please supply the request and its new name, such as '%s move login auth/login'\n", tokens[0])
+			failures++
+			return
+		}
+		c.move(term, config, tokens[2], tokens[3])
+	default:
+		term.printf("Unknown option '%s', try one of [list, show, edit, move, remove, collections]\n", option)
+		failures++
+	}
+}
+
+func (c *requestsCommand) list(term console, name string) {
+	coll, err := loadCollection(name)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	if len(coll.Requests) == 0 {
+		term.printf("Collection %s has no saved requests\n", name)
+		return
+	}
+
+	width := 0
+	for _, r := range coll.Requests {
+		if len(r.path()) > width {
+			width = len(r.path())
+		}
+	}
+
+	term.printf("Collection %s:\n", name)
+	for _, r := range coll.Requests {
+		term.foreground(cyan)
+		term.printf(" %-*s", width, r.path())
+		term.reset()
+		term.printf("  %s %s\n", strings.ToUpper(r.Method), r.URL)
+	}
+}
+
+func (c *requestsCommand) show(term console, coll *collection, path string) {
+	r := coll.find(path)
+	if r == nil {
+		term.printf("There's no saved request called %s\n", path)
+		failures++
+		return
+	}
+
+	spec, err := r.spec()
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+	term.printf("%s\n", spec.commandLine())
+}
+
+//
+// edit opens the request's YAML in an editor, saving it if it's still a valid request.  Changing
+// its name or folder moves it.
+//
+func (c *requestsCommand) edit(term console, coll *collection, path string) {
+	r := coll.find(path)
+	if r == nil {
+		term.printf("There's no saved request called %s\n", path)
+		failures++
+		return
+	}
+
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	edited, err := editBody(term, string(data))
+	if err != nil {
+		term.printf("Couldn't edit %s: %v\n", path, err)
+		failures++
+		return
+	}
+
+	updated := &savedRequest{}
+	err = yaml.Unmarshal([]byte(edited), updated)
+	if err == nil {
+		err = validRequestPath(updated.path())
+	}
+	if err == nil {
+		_, err = updated.spec()
+	}
+	if err == nil && updated.path() != path && coll.find(updated.path()) != nil {
+		err = fmt.Errorf("%s already exists", updated.path())
+	}
+	if err != nil {
+		term.printf("Not saving %s, %v\n", path, err)
+		failures++
+		return
+	}
+
+	*r = *updated
+	if err := coll.write(); err != nil {
+		term.printf("Couldn't save collection %s: %v\n", coll.name, err)
+		failures++
+		return
+	}
+	term.printf("Saved %s\n", r.path())
+}
+
+//
+// move renames a request, possibly into another folder or collection.
+//
+func (c *requestsCommand) move(term console, config *configuration, from, to string) {
+	fromCollection, fromPath := splitRequestName(config, from)
+	toCollection, toPath := splitRequestName(config, to)
+	if err := validRequestPath(toPath); err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	source, err := loadCollection(fromCollection)
+	if err != nil {
+		term.printf("%v\n", err)
+		failures++
+		return
+	}
+
+	target := source
+	if toCollection != fromCollection {
+		target, err = loadCollection(toCollection)
+		if err != nil {
+			term.printf("%v\n", err)
+			failures++
+			return
+		}
+	}
+
+	r := source.find(fromPath)
+	if r == nil || target.find(toPath) != nil {
+		if r == nil {
+			term.printf("There's no saved request called %s\n", from)
+		} else {
+			term.printf("%s already exists\n", to)
+		}
+		failures++
+		return
+	}
+
+	source.remove(fromPath)
+	r.setPath(toPath)
+	target.put(r)
+
+	err = target.write()
+	if err == nil && target != source {
+		err = source.write()
+	}
+	if err != nil {
+		term.printf("Couldn't move %s: %v\n", from, err)
+		failures++
+		return
+	}
+	term.printf("Moved %s to %s\n", from, to)
+}
+
+func (c *requestsCommand) complete(tokens []string) []string {
+	switch {
+	case len(tokens) == 2:
+		return []string{"list", "show", "edit", "move", "remove", "collections"}
+	case len(tokens) == 3 && tokens[1] == "list":
+		names, _ := listCollections()
+		return names
+	case len(tokens) == 3:
+		return savedRequestNames(config)
+	}
+	return nil
+}
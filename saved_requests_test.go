@@ -0,0 +1,210 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//
+// useTempConfigRoot points configRoot at a new directory, returning a function which undoes it.
+//
+func useTempConfigRoot() func() {
+	dir, _ := ioutil.TempDir("", "")
+	saved := configRoot
+	configRoot = dir
+	return func() {
+		configRoot = saved
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSavedRequestRoundTrip(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	spec, _ := parseRequestTokens("POST", []string{"/login", "X-Test:one", "page==2", "user=bob", "age:=5", "| .token"})
+	saved := newSavedRequest("auth/login", spec)
+	if saved.Folder != "auth" || saved.Name != "login" {
+		t.Fatalf("Expected login within auth, found %+v", saved)
+	}
+
+	coll, _ := loadCollection("shop")
+	coll.put(saved)
+	if err := coll.write(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	coll, err := loadCollection("shop")
+	if err != nil || len(coll.Requests) != 1 {
+		t.Fatalf("Expected the request to be read back: %v", err)
+	}
+	loaded, err := coll.find("auth/login").spec()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, spec) {
+		t.Fatalf("Expected %+v, found %+v", spec, loaded)
+	}
+
+	if names, _ := listCollections(); !reflect.DeepEqual(names, []string{"shop"}) {
+		t.Fatalf("Expected the shop collection, found %v", names)
+	}
+}
+
+func TestSaveAndRunRequests(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig, savedSpec := config, lastSpec
+	defer func() { config, lastSpec = savedConfig, savedSpec }()
+	config = defaultConfig()
+	config.settings.Settings["root"] = server.URL
+
+	term := &captureConsole{}
+	before := failures
+	commands := []string{
+		"save-request users/list get /users",
+		"save-request users/create post /users '{\"name\":\"acro\"}'",
+		"save-request broken get /broken",
+		"save-request users/remove delete /users/1",
+	}
+	for _, line := range commands {
+		tokens, _ := tokenize(line)
+		(&saveRequestCommand{}).exec(tokens, term, config)
+	}
+	if failures != before {
+		t.Fatalf("Unexpected failure saving requests: %v", term.String())
+	}
+
+	(&runRequestsCommand{}).exec([]string{"run", "users"}, term, config)
+	expected := []string{"GET /users", "POST /users", "DELETE /users/1"}
+	if failures != before || !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v, found %v (%v)", expected, paths, term.String())
+	}
+
+	paths = nil
+	(&runRequestsCommand{}).exec([]string{"run", "default:users/list", "broken", "users/remove"}, term, config)
+	if failures != before+1 || len(paths) != 2 || !strings.Contains(term.String(), "Stopping, broken failed") {
+		t.Fatalf("Expected the sequence to stop at broken, found %v", paths)
+	}
+
+	(&runRequestsCommand{}).exec([]string{"run", "users/list", "missing"}, term, config)
+	if failures != before+2 || len(paths) != 2 {
+		t.Fatalf("Expected nothing to run when a name is missing, found %v", paths)
+	}
+
+	//
+	// With no request given, the last request command is saved
+	//
+	rememberSpec(&requestSpec{method: "GET", url: "/health", sentinel: "END"})
+	(&saveRequestCommand{}).exec([]string{"save-request", "ops:health"}, term, config)
+	coll, _ := loadCollection("ops")
+	if r := coll.find("health"); r == nil || r.URL != "/health" {
+		t.Fatalf("Expected the last request to be saved, found %+v", coll.Requests)
+	}
+}
+
+func TestRequestsCommand(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	config := defaultConfig()
+	config.settings.Settings["collection"] = "shop"
+	coll, _ := loadCollection("shop")
+	coll.put(&savedRequest{Name: "login", Folder: "auth", Method: "POST", URL: "/login", Body: `{"user":"bob"}`})
+	coll.put(&savedRequest{Name: "logout", Folder: "auth", Method: "POST", URL: "/logout"})
+	coll.put(&savedRequest{Name: "items", Method: "GET", URL: "/items", Items: []string{"page==2"}})
+	coll.write()
+
+	cmd := &requestsCommand{}
+	term := &captureConsole{}
+	cmd.exec([]string{"requests"}, term, config)
+	if !strings.Contains(term.String(), " auth/login   POST /login\n") || !strings.Contains(term.String(), " items        GET /items\n") {
+		t.Fatalf("Unexpected listing %v", term.String())
+	}
+
+	term = &captureConsole{}
+	cmd.exec([]string{"requests", "show", "auth/login"}, term, config)
+	if term.String() != "post /login '{\"user\":\"bob\"}'\n" {
+		t.Fatalf("Unexpected command line %v", term.String())
+	}
+
+	before := failures
+	cmd.exec([]string{"requests", "move", "auth/login", "archive:old/login"}, term, config)
+	cmd.exec([]string{"requests", "remove", "auth"}, term, config)
+	if failures != before {
+		t.Fatalf("Unexpected failure: %v", term.String())
+	}
+
+	coll, _ = loadCollection("shop")
+	archive, _ := loadCollection("archive")
+	if len(coll.Requests) != 1 || archive.find("old/login") == nil {
+		t.Fatalf("Expected login to be archived and logout removed, found %+v and %+v", coll.Requests, archive.Requests)
+	}
+
+	cmd.exec([]string{"requests", "remove", "auth"}, term, config)
+	if failures != before+1 {
+		t.Fatalf("Expected a failure removing a missing folder")
+	}
+}
+
+func TestEditSavedRequest(t *testing.T) {
+	defer useTempConfigRoot()()
+
+	dir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(dir)
+	editor := filepath.Join(dir, "editor.sh")
+	ioutil.WriteFile(editor, []byte("#!/bin/sh\nsed -i 's|/items|/products|' \"$1\"\n"), 0755)
+
+	savedVisual, savedEditor := os.Getenv("VISUAL"), os.Getenv("EDITOR")
+	defer func() {
+		os.Setenv("VISUAL", savedVisual)
+		os.Setenv("EDITOR", savedEditor)
+	}()
+	os.Setenv("VISUAL", editor)
+
+	config := defaultConfig()
+	coll, _ := loadCollection(defaultCollection)
+	coll.put(&savedRequest{Name: "items", Method: "GET", URL: "/items"})
+	coll.write()
+
+	(&requestsCommand{}).exec([]string{"requests", "edit", "items"}, &captureConsole{}, config)
+	coll, _ = loadCollection(defaultCollection)
+	if r := coll.find("items"); r == nil || r.URL != "/products" {
+		t.Fatalf("Expected the edited URL, found %+v", coll.Requests)
+	}
+
+	req, err := buildSavedRequest(config, "items")
+	if err != nil || req.URL.String() != "http://localhost/products" {
+		t.Fatalf("Expected the saved request to build, found %v (%v)", req, err)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+//
+// commandList collects every -e flag given on the command line.
+//
+type commandList []string
+
+func (l *commandList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *commandList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// isComment checks for a line starting with #, these are skipped in scripts.
+func isComment(tokens []string) bool {
+	return len(tokens) > 0 && strings.HasPrefix(tokens[0], "#")
+}
+
+//
+// runNonInteractive runs a script file given with -f, then any -e commands, or if neither were
+// given, reads commands from stdin.  Execution stops at the first failing command, and the exit
+// code to use is returned.
+//
+func runNonInteractive() int {
+	if len(*scriptFile) > 0 {
+		file, err := os.Open(*scriptFile)
+		if err != nil {
+			term.printf("Couldn't run script: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+
+		if !runScript(file) {
+			return 1
+		}
+	}
+
+	for _, line := range expressions {
+		before := failures
+		tokens := tokenizeLine(term, line)
+		if failures != before || !runCommand(tokens) {
+			return 1
+		}
+	}
+
+	if len(*scriptFile) == 0 && len(expressions) == 0 {
+		for {
+			before := failures
+			tokens, err := term.readline()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				term.printf("Couldn't read commands: %v\n", err)
+				return 1
+			}
+
+			if failures != before || (!isComment(tokens) && !runCommand(tokens)) {
+				return 1
+			}
+		}
+	}
+
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+//
+// runScript executes every line read from r as a command.  Blank lines and lines starting
+// with # are ignored.  Returns false as soon as a command fails.
+//
+func runScript(r io.Reader) bool {
+	script := &scriptConsole{console: term, scanner: bufio.NewScanner(r)}
+	saved := term
+	term = script
+	defer func() { term = saved }()
+
+	for script.scanner.Scan() {
+		script.lineNumber++
+		lineNumber := script.lineNumber
+		line := strings.TrimSpace(script.scanner.Text())
+		before := failures
+		tokens := tokenizeLine(term, line)
+		if isComment(tokens) {
+			continue
+		}
+
+		if failures != before || !runCommand(tokens) {
+			term.printf("Stopping, line %d failed: %s\n", lineNumber, line)
+			return false
+		}
+	}
+
+	if err := script.scanner.Err(); err != nil {
+		term.printf("Couldn't read commands: %v\n", err)
+		return false
+	}
+
+	return true
+}
+
+//
+// scriptConsole writes to the console it wraps, but reads raw lines (such as a pasted body)
+// from the script itself.
+//
+type scriptConsole struct {
+	console
+	scanner    *bufio.Scanner
+	lineNumber int
+}
+
+func (s *scriptConsole) readRaw(prompt string) (string, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	s.lineNumber++
+	return s.scanner.Text(), nil
+}
+
+//
+// stdinAvailable determines if stdin is free to be used for something other than commands.
+//
+func stdinAvailable() bool {
+	return len(expressions) > 0 || len(*scriptFile) > 0
+}
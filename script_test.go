@@ -0,0 +1,65 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScriptStopsOnBadLine(t *testing.T) {
+	saved := term
+	defer func() { term = saved }()
+	capture := &captureConsole{}
+	term = capture
+
+	before := failures
+	script := "# the user's script\nvars set a 1\nvars set b \"2\nvars set c 3\n"
+	if runScript(strings.NewReader(script)) {
+		t.Fatalf("Expected the script to fail")
+	}
+	defer delete(variables, "a")
+
+	if failures == before || !strings.Contains(capture.String(), "Stopping, line 3 failed") {
+		t.Fatalf("Expected the unterminated quote to stop the script, found %v", capture.String())
+	}
+	if variables["a"] != "1" || len(variables["c"]) > 0 {
+		t.Fatalf("Expected only the line before the failure to run, found %v", variables)
+	}
+}
+
+func TestExpressionUsageErrors(t *testing.T) {
+	savedTerm, savedConfig, savedExpressions, savedFailures := term, config, expressions, failures
+	defer func() { term, config, expressions, failures = savedTerm, savedConfig, savedExpressions, savedFailures }()
+	term = &captureConsole{}
+	config = defaultConfig()
+	initCommands(config)
+	defer initCommands(defaultConfig())
+
+	for _, line := range []string{"header set X", "header set", "header bogus", "config bogus", "help get extra", "history bogus", "vars unset"} {
+		expressions = commandList{line}
+		if status := runNonInteractive(); status != 1 {
+			t.Fatalf("Expected -e '%s' to exit with 1, found %d", line, status)
+		}
+	}
+
+	failures = 0
+	expressions = commandList{"header set X 1"}
+	if status := runNonInteractive(); status != 0 {
+		t.Fatalf("Expected a valid command to exit with 0, found %d: %v", status, term)
+	}
+}
@@ -17,10 +17,11 @@ limitations under the License.
 package main
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 	"unicode"
 
 	"golang.org/x/crypto/ssh/terminal"
@@ -28,13 +29,35 @@ import (
 
 const (
 	keyEscape = 27
+	keyCtrlG  = 7
+	keyCtrlN  = 14
+	keyCtrlP  = 16
+	keyCtrlR  = 18
+
+	// Stand-ins for the history keys, see historyKeys
+	keyHistoryUp   = '\ue000'
+	keyHistoryDown = '\ue001'
 )
 
-// Term is the abstraction for terminal I/O
+// Term is the console implementation for an interactive, raw mode terminal
 type Term struct {
 	termState *terminal.State
 	term      terminal.Terminal
 	fd        int
+	prompt    string
+
+	// Our position within the command history while navigating with up/down
+	historyIndex   int
+	historyPending string
+
+	// Non-nil while a Ctrl+R reverse search is in progress
+	search *historySearch
+}
+
+type historySearch struct {
+	original string
+	query    string
+	index    int
 }
 
 func createTerm(fd int) *Term {
@@ -45,18 +68,160 @@ func createTerm(fd int) *Term {
 	} else {
 		t.fd = fd
 		t.termState = oldState
-		t.term = *terminal.NewTerminal(os.Stdin, "acro >> ")
+		t.term = *terminal.NewTerminal(&historyKeys{Reader: os.Stdin, Writer: os.Stdin}, "acro >> ")
+		t.term.AutoCompleteCallback = t.handleKey
+		t.prompt = "acro >> "
+		t.historyIndex = -1
 		return t
 	}
 	return nil
 }
 
+// historyKeys translates the up/down arrows and Ctrl+P/Ctrl+N into private use runes as they are read.  The
+// terminal would otherwise decode all four as its own up/down keys, walking its in-memory history (which
+// also holds lines read by readRaw) rather than our persisted one.  Unlike those keys, the private use runes
+// reach handleKey.
+type historyKeys struct {
+	io.Reader
+	io.Writer
+
+	// Translated input that didn't fit in the caller's buffer
+	pending []byte
+}
+
+func (k *historyKeys) Read(buf []byte) (int, error) {
+	if len(k.pending) > 0 {
+		n := copy(buf, k.pending)
+		k.pending = k.pending[n:]
+		return n, nil
+	}
+
+	in := make([]byte, len(buf))
+	n, err := k.Reader.Read(in)
+
+	var out []byte
+	for i := 0; i < n; i++ {
+		switch {
+		case i+2 < n && in[i] == keyEscape && (in[i+1] == '[' || in[i+1] == 'O') && in[i+2] == 'A':
+			out = append(out, string(keyHistoryUp)...)
+			i += 2
+		case i+2 < n && in[i] == keyEscape && (in[i+1] == '[' || in[i+1] == 'O') && in[i+2] == 'B':
+			out = append(out, string(keyHistoryDown)...)
+			i += 2
+		case in[i] == keyCtrlP:
+			out = append(out, string(keyHistoryUp)...)
+		case in[i] == keyCtrlN:
+			out = append(out, string(keyHistoryDown)...)
+		default:
+			out = append(out, in[i])
+		}
+	}
+
+	count := copy(buf, out)
+	k.pending = out[count:]
+	return count, err
+}
+
+// handleKey is the terminal's callback for any key it doesn't handle itself, we use it for history
+// navigation and reverse search.
+func (t *Term) handleKey(line string, pos int, key rune) (string, int, bool) {
+	if t.search != nil {
+		return t.handleSearchKey(line, pos, key)
+	}
+
+	switch key {
+	case keyHistoryUp:
+		index := t.historyIndex
+		if index == -1 {
+			index = len(commandHistory.entries)
+			t.historyPending = line
+		}
+		if index == 0 {
+			return line, pos, true
+		}
+		t.historyIndex = index - 1
+		entry := commandHistory.entries[t.historyIndex]
+		return entry, len(entry), true
+	case keyHistoryDown:
+		if t.historyIndex == -1 {
+			return line, pos, true
+		}
+		t.historyIndex++
+		if t.historyIndex >= len(commandHistory.entries) {
+			t.historyIndex = -1
+			return t.historyPending, len(t.historyPending), true
+		}
+		entry := commandHistory.entries[t.historyIndex]
+		return entry, len(entry), true
+	case keyTab:
+		return t.complete(line, pos)
+	case keyCtrlR:
+		t.search = &historySearch{original: line, index: len(commandHistory.entries)}
+		t.showSearchPrompt()
+		return line, pos, true
+	}
+
+	return "", 0, false
+}
+
+// handleSearchKey extends the query with printable keys, or moves to the next older match on Ctrl+R.
+// Any other key ends the search, leaving the matched line for editing.
+func (t *Term) handleSearchKey(line string, pos int, key rune) (string, int, bool) {
+	switch {
+	case key == keyCtrlR:
+		if len(t.search.query) == 0 {
+			return line, pos, true
+		}
+		if i := commandHistory.search(t.search.query, t.search.index); i >= 0 {
+			t.search.index = i
+		}
+	case key == keyCtrlG:
+		original := t.search.original
+		t.endSearch()
+		return original, len(original), true
+	case key >= 32 && key != 127 && unicode.IsPrint(key):
+		t.search.query += string(key)
+		if i := commandHistory.search(t.search.query, t.search.index+1); i >= 0 {
+			t.search.index = i
+		}
+	default:
+		t.endSearch()
+		return t.handleKey(line, pos, key)
+	}
+
+	t.showSearchPrompt()
+	if t.search.index >= len(commandHistory.entries) {
+		return line, pos, true
+	}
+
+	entry := commandHistory.entries[t.search.index]
+	matchPos := strings.Index(entry, t.search.query)
+	if matchPos < 0 {
+		return entry, len(entry), true
+	}
+	return entry, matchPos + len(t.search.query), true
+}
+
+func (t *Term) showSearchPrompt() {
+	t.term.SetPrompt(fmt.Sprintf("(reverse-i-search)`%s': ", t.search.query))
+	t.term.Write([]byte{})
+}
+
+func (t *Term) endSearch() {
+	t.search = nil
+	t.term.SetPrompt(t.prompt)
+	t.term.Write([]byte{})
+}
+
 func (t *Term) restoreTerm() {
-	terminal.Restore(t.fd, t.termState)
+	if t.termState != nil {
+		terminal.Restore(t.fd, t.termState)
+	}
 }
 
 func (t *Term) setPrompt(prompt string) {
-	t.term.SetPrompt(fmt.Sprintf("%v >> ", prompt))
+	t.prompt = fmt.Sprintf("%v >> ", prompt)
+	t.term.SetPrompt(t.prompt)
 }
 
 func (t *Term) printf(str string, args ...interface{}) {
@@ -73,10 +238,49 @@ func (t *Term) writeBytes(bytes []byte) {
 
 func (t *Term) readline() ([]string, error) {
 	str, err := t.term.ReadLine()
+
+	//
+	// Enter may have been hit in the middle of a search, in which case the prompt needs restoring
+	//
+	if t.search != nil {
+		t.search = nil
+		t.term.SetPrompt(t.prompt)
+	}
+	t.historyIndex = -1
+
 	if err != nil {
 		return nil, err
 	}
-	return t.tokenize(str), nil
+
+	err = commandHistory.add(str)
+	if err != nil {
+		t.printf("Couldn't save history: %v\n", err)
+	}
+
+	return tokenizeLine(t, str), nil
+}
+
+//
+// readRaw reads a line without tokenizing it or adding it to the history, such as a line of a
+// pasted body.
+//
+func (t *Term) readRaw(prompt string) (string, error) {
+	t.term.SetPrompt(prompt)
+	defer t.term.SetPrompt(t.prompt)
+
+	return t.term.ReadLine()
+}
+
+//
+// suspend returns the terminal to its original state, so another program (such as an editor)
+// can use it, until resume is called.
+//
+func (t *Term) suspend() {
+	t.restoreTerm()
+}
+
+func (t *Term) resume() {
+	terminal.MakeRaw(t.fd)
 }
 
 func (t *Term) bright() {
@@ -91,68 +295,10 @@ func (t *Term) underscore() {
 	t.term.Write([]byte{keyEscape, '[', '0', '4', 'm'})
 }
 
-func (t *Term) reset() {
-	t.term.Write([]byte{keyEscape, '[', '0', '0', 'm'})
+func (t *Term) foreground(color textColor) {
+	t.term.Write([]byte{keyEscape, '[', '3', byte(color), 'm'})
 }
 
-func (t *Term) tokenize(str string) []string {
-
-	// Final tokenized set of strings.  5 is a pretty middle of the road choice
-	tokens := make([]string, 0, 5)
-
-	// Used to build the intermediate token
-	buffer := bytes.NewBuffer(make([]byte, 0, 0))
-
-	isDoubleQuoted := false
-	isEscaped := false
-
-	for _, rune := range str {
-		//
-		// If we are in escaped mode, write the previous character
-		// literally.
-		//
-		if isEscaped {
-			buffer.WriteRune(rune)
-			isEscaped = false
-			continue
-		}
-
-		char := fmt.Sprintf("%c", rune)
-
-		if char == "\\" {
-			isEscaped = true
-			continue
-		}
-
-		if char == "\"" {
-			isDoubleQuoted = !isDoubleQuoted
-			continue
-		}
-
-		//
-		// We only care if we are not in double quotes
-		//
-		if unicode.IsSpace(rune) && !isDoubleQuoted {
-			tokens = append(tokens, buffer.String())
-			buffer.Reset()
-		} else {
-			buffer.WriteRune(rune)
-		}
-
-	}
-
-	//
-	// At this point we should certainly be out of any quoted context
-	//
-	if isDoubleQuoted {
-		t.writeString("Error, double quotes don't seem to match up\n")
-		return []string{}
-	}
-
-	//
-	// Push the remaining string
-	//
-	tokens = append(tokens, buffer.String())
-
-	return tokens
+func (t *Term) reset() {
+	t.term.Write([]byte{keyEscape, '[', '0', '0', 'm'})
 }
@@ -0,0 +1,158 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timingBarWidth = 40
+
+//
+// requestTiming holds the points in time reached while performing a request.  When redirects are
+// followed the connection phases are those of the final hop, while the total covers every hop.
+//
+type requestTiming struct {
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	done         time.Time
+	conn         httptrace.GotConnInfo
+}
+
+//
+// timingPhase is a single named span of a request, relative to its start.
+//
+type timingPhase struct {
+	name     string
+	offset   time.Duration
+	duration time.Duration
+	skipped  bool
+}
+
+func newRequestTiming() *requestTiming {
+	return &requestTiming{start: time.Now()}
+}
+
+//
+// trace returns a ClientTrace which records into this timing.
+//
+func (t *requestTiming) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			// Each hop starts afresh, so a reused connection doesn't show the previous hop's phases
+			t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+			t.connectStart, t.connectDone = time.Time{}, time.Time{}
+			t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.dnsDone = time.Now()
+		},
+		ConnectStart: func(network, addr string) {
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.connectDone = time.Now()
+		},
+		TLSHandshakeStart: func() {
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.tlsDone = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.gotConn = time.Now()
+			t.conn = info
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.firstByte = time.Now()
+		},
+	}
+}
+
+func (t *requestTiming) phase(name string, from, to time.Time) timingPhase {
+	if from.IsZero() || to.IsZero() {
+		return timingPhase{name: name, skipped: true}
+	}
+	return timingPhase{name: name, offset: from.Sub(t.start), duration: to.Sub(from)}
+}
+
+//
+// phases breaks the request down into DNS, connect, TLS, time to first byte and content transfer,
+// followed by the total.  Phases which didn't happen, such as DNS on a reused connection, are skipped.
+//
+func (t *requestTiming) phases() []timingPhase {
+	return []timingPhase{
+		t.phase("DNS lookup", t.dnsStart, t.dnsDone),
+		t.phase("TCP connect", t.connectStart, t.connectDone),
+		t.phase("TLS handshake", t.tlsStart, t.tlsDone),
+		t.phase("First byte", t.gotConn, t.firstByte),
+		t.phase("Transfer", t.firstByte, t.done),
+		t.phase("Total", t.start, t.done),
+	}
+}
+
+//
+// printTiming shows each phase along with a bar positioned within the total time.
+//
+func printTiming(prompt string, term console, t *requestTiming) {
+	total := t.done.Sub(t.start)
+
+	for _, p := range t.phases() {
+		if p.skipped {
+			term.printf("%v %-14s %10s\n", prompt, p.name, "-")
+			continue
+		}
+
+		bar := ""
+		if total > 0 {
+			start := int(int64(p.offset) * timingBarWidth / int64(total))
+			width := int(int64(p.duration) * timingBarWidth / int64(total))
+			if width == 0 {
+				width = 1
+			}
+			if start+width > timingBarWidth {
+				start = timingBarWidth - width
+			}
+			bar = strings.Repeat(" ", start) + strings.Repeat("=", width)
+		}
+		term.printf("%v %-14s %10s  |%-*s|\n", prompt, p.name, formatMillis(p.duration), timingBarWidth, bar)
+	}
+}
+
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64) + "ms"
+}
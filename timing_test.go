@@ -0,0 +1,70 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+	configureClient(defaultConfig())
+
+	timings := make([]*requestTiming, 2)
+	for i := range timings {
+		timing := newRequestTiming()
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), timing.trace()))
+
+		response, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		timing.done = time.Now()
+		timings[i] = timing
+	}
+
+	phases := timings[0].phases()
+	if len(phases) != 6 || phases[1].skipped || phases[3].duration < 20*time.Millisecond {
+		t.Fatalf("Expected a connect phase and at least 20ms to first byte, found %+v", phases)
+	}
+	if total := phases[5]; total.offset != 0 || total.duration < phases[3].duration {
+		t.Fatalf("Expected the total to cover every phase, found %+v", total)
+	}
+
+	if !timings[1].conn.Reused || !timings[1].phases()[1].skipped {
+		t.Fatalf("Expected the second request to reuse the connection, found %+v", timings[1].phases())
+	}
+
+	capture := &captureConsole{}
+	printTiming(" ~ ", capture, timings[1])
+	if !strings.Contains(capture.String(), "TCP connect") || !strings.Contains(capture.String(), "|") {
+		t.Fatalf("Expected a waterfall, found %v", capture.String())
+	}
+}
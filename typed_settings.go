@@ -0,0 +1,165 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type settingType int
+
+const (
+	stringSetting settingType = iota
+	boolSetting
+	intSetting
+	durationSetting
+	choiceSetting
+)
+
+//
+// settingInfo describes a setting acromantula understands.  Settings are always stored as strings, but
+// known settings are validated when set so mistakes show up immediately rather than on the next request.
+//
+type settingInfo struct {
+	kind    settingType
+	choices []string
+}
+
+var knownSettings = map[string]settingInfo{
+	"root":            {kind: stringSetting},
+	"prompt":          {kind: stringSetting},
+	"persist-cookies": {kind: boolSetting},
+	"proxy":           {kind: stringSetting},
+	"ca-bundle":       {kind: stringSetting},
+	"client-cert":     {kind: stringSetting},
+	"client-key":      {kind: stringSetting},
+	"sni":             {kind: stringSetting},
+	"tls-min-version": {kind: choiceSetting, choices: []string{"1.0", "1.1", "1.2", "1.3"}},
+	"insecure":        {kind: boolSetting},
+	"timeout":         {kind: durationSetting},
+	"connect-timeout": {kind: durationSetting},
+	"tls-timeout":     {kind: durationSetting},
+	"header-timeout":  {kind: durationSetting},
+	"redirects":       {kind: choiceSetting, choices: []string{"follow", "none"}},
+	"max-redirects":   {kind: intSetting},
+	"keep-alive":      {kind: boolSetting},
+	"timing":          {kind: boolSetting},
+	"raw-output":      {kind: boolSetting},
+	"chunked":         {kind: boolSetting},
+	"collection":      {kind: stringSetting},
+}
+
+func knownSettingNames() []string {
+	names := make([]string, 0, len(knownSettings))
+	for name := range knownSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//
+// validateSetting checks value is appropriate for key, unknown settings are always valid.
+//
+func validateSetting(key, value string) error {
+	info, ok := knownSettings[key]
+	if !ok {
+		return nil
+	}
+
+	var err error
+	switch info.kind {
+	case boolSetting:
+		_, err = parseBool(value)
+	case intSetting:
+		_, err = strconv.Atoi(value)
+		if err != nil {
+			err = fmt.Errorf("'%s' isn't a whole number", value)
+		}
+	case durationSetting:
+		_, err = parseDuration(value)
+	case choiceSetting:
+		for _, choice := range info.choices {
+			if value == choice {
+				return nil
+			}
+		}
+		err = fmt.Errorf("'%s' must be one of [%s]", value, strings.Join(info.choices, ", "))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Bad value for %s: %v", key, err)
+	}
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' should be true or false", value)
+}
+
+//
+// parseDuration accepts Go style durations (10s, 500ms, 1m30s) or a bare number of seconds.
+//
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' isn't a duration, try something like 10s or 500ms", value)
+	}
+	return d, nil
+}
+
+//
+// The following return the typed value of a setting, falling back to def if it is unset or invalid.
+//
+
+func boolSettingValue(settings map[string]string, key string, def bool) bool {
+	value, err := parseBool(settings[key])
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+func intSettingValue(settings map[string]string, key string, def int) int {
+	value, err := strconv.Atoi(settings[key])
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+func durationSettingValue(settings map[string]string, key string, def time.Duration) time.Duration {
+	value, err := parseDuration(settings[key])
+	if err != nil {
+		return def
+	}
+	return value
+}
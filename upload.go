@@ -0,0 +1,148 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Request bodies at least this large show upload progress
+const uploadProgressSize = 1024 * 1024
+
+// Set once stdin has been used as a request body, it can't be read twice.
+var stdinRead = false
+
+//
+// attachBodyFile makes the file the request's body, streaming it from disk rather than reading
+// it into memory.  A path of '-' reads the body from stdin instead, which is only possible when
+// commands aren't being read from there as well.
+//
+func attachBodyFile(req *http.Request, path string) error {
+	if path == "-" {
+		if !stdinAvailable() {
+			return fmt.Errorf("@- reads the body from stdin, which is only possible when running with -e or -f")
+		}
+		if stdinRead {
+			return fmt.Errorf("stdin has already been read by an earlier request")
+		}
+		stdinRead = true
+
+		req.Body = stdinBody{os.Stdin}
+		req.ContentLength = -1
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %v: %v", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return fmt.Errorf("cannot read %v: not a regular file", path)
+	}
+
+	//
+	// An empty body must be NoBody, otherwise it's sent chunked as if its length were unknown
+	//
+	if info.Size() == 0 {
+		file.Close()
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		req.ContentLength = 0
+		return nil
+	}
+
+	req.Body = file
+	req.GetBody = func() (io.ReadCloser, error) { return os.Open(path) }
+	req.ContentLength = info.Size()
+	return nil
+}
+
+//
+// stdinBody is a request body read from stdin, which is left open once it has been sent.
+//
+type stdinBody struct {
+	io.Reader
+}
+
+func (stdinBody) Close() error {
+	return nil
+}
+
+//
+// isStreamedBody determines if a request's body is streamed from a file or stdin, rather than
+// held in memory.
+//
+func isStreamedBody(body io.ReadCloser) bool {
+	switch body.(type) {
+	case *os.File, stdinBody:
+		return true
+	}
+	return false
+}
+
+//
+// idleReader restarts an idleTimeout whenever some of the body is read, so the timeout only
+// applies to a stalled upload.
+//
+type idleReader struct {
+	io.ReadCloser
+	idle *idleTimeout
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.idle.touch()
+	return n, err
+}
+
+//
+// progressReader reports the bytes read through it to a progressWriter.
+//
+type progressReader struct {
+	io.ReadCloser
+	progress *progressWriter
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.progress.Write(p[:n])
+	return n, err
+}
+
+//
+// trackUpload shows progress while a large, or unknown length, body is sent.  The returned
+// progressWriter should be finished once the request is complete, and is nil if there's no progress
+// to show.
+//
+func trackUpload(term console, req *http.Request) *progressWriter {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.ContentLength >= 0 && req.ContentLength < uploadProgressSize {
+		return nil
+	}
+
+	progress := &progressWriter{term: term, total: req.ContentLength}
+	req.Body = &progressReader{ReadCloser: req.Body, progress: progress}
+	return progress
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamedUpload(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, fmt.Sprintf("%d %v %d", r.ContentLength, r.TransferEncoding, len(body)))
+	}))
+	defer server.Close()
+
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config = defaultConfig()
+	capture := &captureConsole{}
+
+	content := bytes.Repeat([]byte("x"), 2*uploadProgressSize)
+	file, _ := ioutil.TempFile("", "")
+	defer os.Remove(file.Name())
+	file.Write(content)
+	file.Close()
+
+	put := &httpBodyCommand{method: "PUT"}
+	put.exec([]string{"put", server.URL, "@" + file.Name()}, capture, config)
+	if len(received) != 1 || received[0] != "2097152 [] 2097152" {
+		t.Fatalf("Expected a Content-Length for the file, found %v", received)
+	}
+	if !strings.Contains(capture.String(), "100%  2.0 MB / 2.0 MB") {
+		t.Fatalf("Expected upload progress, found %v", capture.String())
+	}
+
+	(&replayCommand{}).exec([]string{"!!"}, capture, config)
+	if len(received) != 2 || received[1] != received[0] {
+		t.Fatalf("Expected the file to be sent again, found %v", received)
+	}
+
+	config.settings.Settings["chunked"] = "true"
+	put.exec([]string{"put", server.URL, "@" + file.Name()}, capture, config)
+	if len(received) != 3 || received[2] != "-1 [chunked] 2097152" {
+		t.Fatalf("Expected a chunked upload, found %v", received)
+	}
+}
+
+func TestEmptyAndStdinBodies(t *testing.T) {
+	file, _ := ioutil.TempFile("", "")
+	defer os.Remove(file.Name())
+	file.Close()
+
+	req, _ := http.NewRequest("POST", "http://example.com", nil)
+	if err := attachBodyFile(req, file.Name()); err != nil || req.Body != http.NoBody || req.ContentLength != 0 {
+		t.Fatalf("Expected an empty body, found %v (%v)", req.Body, err)
+	}
+
+	if err := attachBodyFile(req, os.TempDir()); err == nil {
+		t.Fatalf("Expected a non-nil error value for a directory!")
+	}
+
+	if err := attachBodyFile(req, "-"); err == nil || !strings.Contains(err.Error(), "stdin") {
+		t.Fatalf("Expected stdin to be unavailable, found %v", err)
+	}
+}
+
+//
+// slowReader gives a chunk at a time, pausing before each one as a slow pipe on stdin would.
+//
+type slowReader struct {
+	chunks int
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.chunks == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(40 * time.Millisecond)
+	r.chunks--
+	return copy(p, "0123456789"), nil
+}
+
+func TestStreamedUploadTimeout(t *testing.T) {
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = len(body)
+	}))
+	defer server.Close()
+	defer configureClient(defaultConfig())
+
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config = defaultConfig()
+	config.settings.Settings["timeout"] = "100ms"
+	capture := &captureConsole{}
+
+	//
+	// The body takes longer than the timeout to send, but it's never idle for that long
+	//
+	req, _ := http.NewRequest("PUT", server.URL, nil)
+	req.Body = stdinBody{&slowReader{chunks: 8}}
+	req.ContentLength = -1
+	if err := doRequest(capture, req, responseOptions{}); err != nil || received != 80 {
+		t.Fatalf("Expected the whole body to be sent, found %d bytes (%v)", received, err)
+	}
+
+	//
+	// A file opened for the body is closed even if the request can't be sent
+	//
+	file, _ := ioutil.TempFile("", "")
+	defer os.Remove(file.Name())
+	file.WriteString("spider")
+	file.Close()
+
+	req, _ = http.NewRequest("PUT", server.URL, nil)
+	attachBodyFile(req, file.Name())
+	body := req.Body.(*os.File)
+	config.settings.Settings["ca-bundle"] = file.Name()
+	if err := doRequest(capture, req, responseOptions{}); err == nil {
+		t.Fatalf("Expected a non-nil error value for a bad ca-bundle!")
+	}
+	if _, err := body.Read(make([]byte, 1)); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("Expected the body's file to be closed, found %v", err)
+	}
+}
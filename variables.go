@@ -0,0 +1,134 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+//
+// Session variables, these live for the lifetime of the process and are shared across
+// configurations.
+//
+var variables = make(map[string]string)
+
+var variablePattern = regexp.MustCompile(`{{\s*([A-Za-z0-9_.\-]+)\s*}}`)
+
+//
+// interpolate replaces every {{name}} in str with the value of the named variable, or failing that
+// the active configuration's setting of the same name (such as those imported from a Postman
+// environment).  Referencing a variable that hasn't been set is an error.
+//
+func interpolate(str string) (string, error) {
+	var err error
+
+	result := variablePattern.ReplaceAllStringFunc(str, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+		value, ok := variables[name]
+		if !ok && config != nil {
+			value, ok = config.settings.Settings[name]
+		}
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("Unknown variable '%s'", name)
+			}
+			return match
+		}
+		return value
+	})
+
+	return result, err
+}
+
+type extractCommand struct{}
+
+func (c *extractCommand) description() string {
+	return "Extracts a value from the last response into a variable, for use as {{name}}"
+}
+
+func (c *extractCommand) usage() string {
+	return "<name> <query> | <name> header <Header> | <name> status"
+}
+
+func (c *extractCommand) exec(tokens []string, term console, config *configuration) {
+	if len(tokens) < 3 {
+		term.printf("Usage: %s %s\n", tokens[0], c.usage())
+		failures++
+		return
+	}
+
+	if lastResponse == nil {
+		term.writeString("No response to extract from, make a request first\n")
+		failures++
+		return
+	}
+
+	name := tokens[1]
+	var value string
+
+	switch tokens[2] {
+	case "header":
+		if len(tokens) < 4 {
+			term.printf("Please supply a header name, such as '%s %s header Location'\n", tokens[0], name)
+			failures++
+			return
+		}
+		if len(lastResponse.header[http.CanonicalHeaderKey(tokens[3])]) == 0 {
+			term.printf("The last response has no %s header\n", tokens[3])
+			failures++
+			return
+		}
+		value = lastResponse.header.Get(tokens[3])
+	case "status":
+		value = strconv.Itoa(lastResponse.statusCode)
+	default:
+		if !bodyKept(term) {
+			return
+		}
+		data, err := decodeJSON(lastResponse.body)
+		if err != nil {
+			term.printf("The last response isn't valid JSON: %v\n", err)
+			failures++
+			return
+		}
+
+		result, err := queryValue(data, tokens[2])
+		if err != nil {
+			term.printf("Couldn't extract %s: %v\n", tokens[2], err)
+			failures++
+			return
+		}
+		value = formatValue(result)
+	}
+
+	variables[name] = value
+	term.printf(" %v => %v\n", name, value)
+}
+
+func (c *extractCommand) complete(tokens []string) []string {
+	if len(tokens) == 3 {
+		return []string{"header", "status"}
+	}
+
+	if len(tokens) == 4 && tokens[2] == "header" && lastResponse != nil {
+		return sortHeaders(lastResponse.header)
+	}
+	return nil
+}
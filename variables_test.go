@@ -0,0 +1,115 @@
+/*
+Copyright 2017 Jason Nichols (jason@kickroot.com)
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestInterpolate(t *testing.T) {
+	variables["id"] = "42"
+	defer delete(variables, "id")
+
+	result, err := interpolate("/users/{{id}}/posts/{{ id }}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result != "/users/42/posts/42" {
+		t.Fatalf("Bad interpolation: %v", result)
+	}
+}
+
+func TestInterpolateUnknown(t *testing.T) {
+	_, err := interpolate("/users/{{missing}}")
+	if err == nil {
+		t.Fatalf("Expected a non-nil error value!")
+	}
+}
+
+func TestInterpolateSettings(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config = defaultConfig()
+	config.settings.Settings["baseUrl"] = "https://staging.example.com"
+	variables["root"] = "https://example.com"
+	defer delete(variables, "root")
+
+	result, err := interpolate("{{baseUrl}}/items {{root}}")
+	if err != nil || result != "https://staging.example.com/items https://example.com" {
+		t.Fatalf("Expected settings to be used when there's no variable, found %v (%v)", result, err)
+	}
+}
+
+func TestInterpolatedRequest(t *testing.T) {
+	variables["token"] = "abc"
+	variables["count"] = "3"
+	defer delete(variables, "token")
+	defer delete(variables, "count")
+
+	config := defaultConfig()
+	config.settings.Settings["root"] = "https://example.com"
+	config.settings.Headers["Authorization"] = "Bearer {{token}}"
+
+	spec, err := parseRequestTokens("POST", []string{"/items/{{count}}", "size:={{count}}"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request, err := spec.build(config, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if request.URL.Path != "/items/3" {
+		t.Fatalf("Bad path: %v", request.URL.Path)
+	}
+
+	if request.Header.Get("Authorization") != "Bearer abc" {
+		t.Fatalf("Bad Authorization header: %v", request.Header.Get("Authorization"))
+	}
+}
+
+func TestQueryValue(t *testing.T) {
+	data, _ := decodeJSON([]byte(`{"access_token":"abc","items":[{"id":1},{"id":2,"tags":["x"]}],"odd key":true}`))
+
+	cases := map[string]string{
+		"$.access_token":   "abc",
+		".access_token":    "abc",
+		"$.items[1].id":    "2",
+		"$.items[-1].tags": `["x"]`,
+		"$['odd key']":     "true",
+		".items[0].id":     "1",
+		"$.items[].id":     "[1,2]",
+		".items | length":  "2",
+	}
+
+	for path, expected := range cases {
+		result, err := queryValue(data, path)
+		if err != nil {
+			t.Fatalf("Unexpected error for %v: %v", path, err)
+		}
+		if formatValue(result) != expected {
+			t.Fatalf("Expected %v for %v, found %v", expected, path, formatValue(result))
+		}
+	}
+
+	for _, path := range []string{"$.missing", "$.items[5]", "$.access_token.foo", "$.items[x]"} {
+		_, err := queryValue(data, path)
+		if err == nil {
+			t.Fatalf("Expected a non-nil error value for %v!", path)
+		}
+	}
+}